@@ -1,48 +1,402 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"math"
+	"math/rand/v2"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Program configuration
 type Config struct {
-	MaxRetries       int
-	RetryDelay       time.Duration
-	Aria2cArgs       string
-	OutputTemplate   string
-	UseAria2c        bool
-	Stdout           io.Writer
-	Stderr           io.Writer
-	IsAudioOnly      bool
-	AudioFormat      string
-	Resolution       string
-	CookieBrowser    string
-	DownloadLocation string
-}
-
-// Config with default values
-func New() *Config {
+	MaxRetries     int
+	RetryDelay     time.Duration
+	MaxRetryDelay  time.Duration // Cap for the doubling retry delay, 0 for none
+	CommandTimeout time.Duration // Limit for each yt-dlp metadata query, 0 for none
+	FormatCacheTTL time.Duration // How long listed formats are reused per URL, 0 to always re-query
+	Aria2cArgs     string
+	OutputTemplate string
+	// Per content type templates, empty falls back to OutputTemplate
+	AudioOutputTemplate         string
+	VideoOutputTemplate         string
+	PlaylistAudioOutputTemplate string
+	PlaylistVideoOutputTemplate string
+	UseAria2c                   bool
+	PreferBundled               bool // Put bundled binaries ahead of ones in PATH
+	DirectDownload              bool // Download single videos straight into the destination, skipping the temp dir
+	NativeHTTP                  bool // Fetch direct media links with the built-in downloader instead of yt-dlp
+	NoPart                      bool // Write straight to the final filename instead of a .part file
+	WriteM3U                    bool // Write an .m3u8 of the downloaded items after a playlist run
+	DateFolders                 bool // Sort downloads into YYYY/MM folders by upload date
+	AudioFallback               bool // Switch to audio only without asking when a video has no video formats
+	AlbumMode                   bool // Tag audio playlist downloads as one album with sequential track numbers
+	PreflightCheck              bool // Check the target site is reachable before starting
+	ForceUpdate                 bool // Check for newer dependencies now instead of once every 24 hours
+	AudioNormalize              bool // Normalize loudness of extracted audio with ffmpeg's loudnorm
+	WriteLiveChat               bool // Save the chat replay of archived livestreams next to the video
+	WriteSubs                   bool // Download subtitles in SubLangs, embedding them into videos
+	AutoSubs                    bool // Include auto-generated subtitles when WriteSubs finds none
+	EmbedThumbnail              bool // Embed the thumbnail as cover art into the output file
+	EmbedMetadata               bool // Embed title, artist and other tags into the output file
+	SponsorBlockMark            bool // Mark SponsorBlock segments as chapters instead of removing them
+	QueryOnly                   bool // Only metadata is requested, so aria2 is never needed
+	Stdout                      io.Writer
+	Stderr                      io.Writer
+	IsAudioOnly                 bool
+	IsPlaylist                  bool
+	AudioFormat                 string
+	Resolution                  string
+	DefaultFormat               string // Format used when no resolution is picked, what the TUI's Default choice means
+	RawFormat                   bool   // Pass Resolution to --format verbatim
+	AudioMultistreams           bool   // Allow format expressions to merge several audio streams
+	VideoMultistreams           bool   // Allow format expressions to merge several video streams
+	ConcurrentFragments         string // Fragments fetched in parallel for HLS/DASH, empty uses per-site defaults
+	CookieBrowser               string
+	CookieFile                  string // Netscape cookies.txt passed to --cookies, takes precedence over CookieBrowser
+	Impersonate                 string // yt-dlp --impersonate target, e.g. "chrome"
+	WaitForVideo                string // Seconds between checks for upcoming videos, "MIN" or "MIN-MAX"
+	TrimFilenames               int    // Max filename length in characters, 0 means no limit
+	MaxFilesize                 int64  // Abort a download once it grows past this many bytes, 0 for no limit
+	URLConcurrency              int    // Top-level URLs downloaded at once
+	FormatProbeConcurrency      int    // Format listings the TUI runs ahead in the background, 0 for none
+	MaxFailStreak               int    // Abort a playlist after this many items fail in a row, 0 never aborts
+	Nice                        int    // Niceness of yt-dlp and its children, -20 to 19 like nice(1), 0 leaves it unchanged
+	DefaultSubLang              string // Subtitle language marked default when several are embedded
+	SubLangs                    string // yt-dlp --sub-langs value for WriteSubs, empty means "en"
+	ChaptersFrom                string // Where to read chapters for videos without them: "description" or "comments"
+	SponsorBlock                string // Comma-separated SponsorBlock categories to remove or mark, e.g. "sponsor,intro" or "all"
+	ThumbnailID                 string // Thumbnail to write or embed, an id from --list-thumbnails or "largest"
+	PerDownloadLimit            string // aria2c --max-download-limit, caps each file or fragment, e.g. "500K"
+	OverallDownloadLimit        string // aria2c --max-overall-download-limit, caps each aria2c run as a whole, e.g. "2M"
+	RateLimit                   string // Overall download speed cap for metered connections, e.g. "2M", clamps connection counts
+	MergeOutputFormat           string // Container merged video downloads are written in, e.g. "mkv", empty lets yt-dlp choose
+	PlaylistItems               string // yt-dlp --playlist-items value picking playlist items, e.g. "1-5,8", empty for all
+	OnExisting                  string // What to do when the output file already exists, one of the OnExisting* values
+	DownloadLocation            string
+	DepsDir                     string // Where downloaded dependencies are kept, YARIA_DEPS_DIR takes precedence
+	YTDLPPath                   string // yt-dlp executable to run instead of the one on PATH or in DepsDir
+	Proxy                       string // Proxy URL for yt-dlp, aria2c and dependency downloads, e.g. "http://proxy:3128"
+	GitHubToken                 string // Token for GitHub release lookups, GITHUB_TOKEN takes precedence
+
+	PostprocessorArgs []string // Raw yt-dlp --postprocessor-args values, each "NAME:ARGS"
+	SleepInterval     float64  // Seconds to wait before each playlist item, 0 for no wait
+	MaxSleepInterval  float64  // Upper bound for a random wait between SleepInterval and this
+	SleepRequests     float64  // Seconds to wait between extraction requests in a playlist
+
+	// Host to token for sites using token auth, sent as an Authorization header.
+	// yt-dlp sends added headers with every request of a download, keep tokens to trusted hosts.
+	AuthTokens map[string]string
+}
+
+// Config with default values, overridden by the user's config file when present. Problems with
+// the file come back as warnings for the caller to log once its logger is set up.
+func New() (*Config, []string) {
+	return loadDefaultConfig()
+}
+
+// Built-in default values
+func defaults() *Config {
 	return &Config{
 		MaxRetries:       3,
 		RetryDelay:       5 * time.Second,
+		MaxRetryDelay:    time.Minute,
+		CommandTimeout:   60 * time.Second,
+		FormatCacheTTL:   5 * time.Minute,
 		Aria2cArgs:       "--max-connection-per-server=16 --min-split-size=1M --split=32 --max-concurrent-downloads=16 --file-allocation=none --optimize-concurrent-downloads=true --disk-cache=64M --max-tries=5 --retry-wait=2 --timeout=30 --connect-timeout=30 --lowest-speed-limit=10K --continue=true --allow-overwrite=true --allow-piece-length-change=true --enable-rpc=false --enable-http-pipelining=true --enable-http-keep-alive=true --enable-mmap=true --enable-color=false --summary-interval=0 --log-level=error --console-log-level=error",
 		OutputTemplate:   "%(title)s.%(ext)s",
 		UseAria2c:        true,
+		URLConcurrency:   1,
+		MaxFailStreak:    5,
+		OnExisting:       OnExistingSkip,
+		PreflightCheck:   true,
 		Stdout:           os.Stdout,
 		Stderr:           os.Stderr,
 		IsAudioOnly:      false,
 		AudioFormat:      "mp3",
 		Resolution:       "",
+		DefaultFormat:    BestFormat,
 		CookieBrowser:    "",
 		DownloadLocation: "",
 	}
 }
 
-// Logs and waits before retrying
-func (c *Config) WaitBeforeRetry(attempt int) {
-	fmt.Fprintf(c.Stdout, "Waiting %v before retrying...\n", c.RetryDelay)
-	time.Sleep(c.RetryDelay)
+// Upper bound for URLConcurrency so parallel URLs don't saturate the connection
+const MaxURLConcurrency = 8
+
+// Built-in DefaultFormat, the best video and audio streams merged
+const BestFormat = "bestvideo+bestaudio/best"
+
+// Audio formats accepted by yt-dlp's --audio-format
+var AudioFormats = []string{"best", "aac", "alac", "flac", "m4a", "mp3", "opus", "vorbis", "wav"}
+
+// Turns a height like "1080p" into a format selector, passing format ids through
+func ResolutionFormat(value string) string {
+	if height, ok := strings.CutSuffix(value, "p"); ok {
+		if _, err := strconv.Atoi(height); err == nil {
+			return "bestvideo[height<=" + height + "]"
+		}
+	}
+	return value
+}
+
+// OnExisting values
+const (
+	OnExistingSkip      = "skip"      // Keep the existing file and don't download
+	OnExistingOverwrite = "overwrite" // Download and replace the existing file
+	OnExistingRename    = "rename"    // Download and save next to it under a numbered name
+	OnExistingError     = "error"     // Fail the download
+)
+
+// Checks that OnExisting is one of the OnExisting* values
+func (c *Config) ValidateOnExisting() error {
+	switch c.OnExisting {
+	case OnExistingSkip, OnExistingOverwrite, OnExistingRename, OnExistingError:
+		return nil
+	}
+	return fmt.Errorf("invalid on-existing value %q, expected %s, %s, %s or %s",
+		c.OnExisting, OnExistingSkip, OnExistingOverwrite, OnExistingRename, OnExistingError)
+}
+
+// Checks that YTDLPPath, when set, is an executable file and resolves it to its full path
+func (c *Config) ValidateYTDLPPath() error {
+	if c.YTDLPPath == "" {
+		return nil
+	}
+	info, err := os.Stat(c.YTDLPPath)
+	if err != nil {
+		return fmt.Errorf("yt-dlp path %s: %v", c.YTDLPPath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("yt-dlp path %s is a directory", c.YTDLPPath)
+	}
+	path, err := exec.LookPath(c.YTDLPPath)
+	if err != nil {
+		return fmt.Errorf("yt-dlp path %s is not executable", c.YTDLPPath)
+	}
+	if c.YTDLPPath, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Checks that Proxy, when set, is a URL with a scheme yt-dlp understands and a host
+func (c *Config) ValidateProxy() error {
+	if c.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Proxy)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid proxy %q, expected a URL like http://proxy:3128", c.Proxy)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks4", "socks4a", "socks5", "socks5h":
+		return nil
+	}
+	return fmt.Errorf("unsupported proxy scheme %q, expected http, https, socks4, socks4a, socks5 or socks5h", u.Scheme)
+}
+
+// Reports whether Proxy is a SOCKS proxy, which aria2c can't use
+func (c *Config) SOCKSProxy() bool {
+	return strings.HasPrefix(c.Proxy, "socks")
+}
+
+// Folders prepended to the output filename with DateFolders, YYYY/MM of the upload date
+const DateFoldersPrefix = "%(upload_date>%Y)s/%(upload_date>%m)s/"
+
+// ConcurrentFragments value that sizes fragment concurrency from the machine and connection
+const AutoFragments = "auto"
+
+// Bounds for automatically chosen fragment counts
+const (
+	minAutoFragments = 2
+	maxAutoFragments = 32
+)
+
+// Picks a fragment count from the CPU count and, once a download has measured it,
+// the connection speed: roughly one fragment per MiB/s, as slow links gain nothing from more
+func autoFragmentCount(bandwidth float64) int {
+	n := runtime.NumCPU() * 4
+	if bandwidth > 0 {
+		n = min(n, int(math.Ceil(bandwidth/(1<<20))))
+	}
+	return max(minAutoFragments, min(n, maxAutoFragments))
+}
+
+// Connections a download may open while RateLimit is set, more only add overhead at a capped speed
+const rateLimitedConnections = 4
+
+// Resolves ConcurrentFragments, using def when unset or invalid, and clamps it under RateLimit.
+// bandwidth is the measured speed in bytes per second auto mode sizes by, 0 when unknown.
+func (c *Config) FragmentCount(def int, bandwidth float64) int {
+	n := def
+	if c.ConcurrentFragments == AutoFragments {
+		n = autoFragmentCount(bandwidth)
+	} else if count, err := strconv.Atoi(c.ConcurrentFragments); err == nil && count >= 1 {
+		n = count
+	}
+	if c.RateLimit != "" {
+		n = min(n, rateLimitedConnections)
+	}
+	return n
+}
+
+// Lowers a numeric aria2c "--name=N" arg to at most limit
+func clampArg(arg, prefix string, limit int) string {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, prefix))
+	if err != nil || n <= limit {
+		return arg
+	}
+	return prefix + strconv.Itoa(limit)
+}
+
+// Returns Aria2cArgs, with split and connection counts sized to the fragment count in auto mode
+// and clamped under RateLimit, and the download limits replaced by PerDownloadLimit and
+// OverallDownloadLimit when set. RateLimit stands in for OverallDownloadLimit when that is unset.
+// bandwidth is passed on to FragmentCount.
+func (c *Config) Aria2cArgsResolved(bandwidth float64) string {
+	auto := c.ConcurrentFragments == AutoFragments
+	n := 0
+	if auto {
+		n = c.FragmentCount(0, bandwidth)
+	}
+	overallLimit := c.OverallDownloadLimit
+	if overallLimit == "" {
+		overallLimit = c.RateLimit
+	}
+	limited := c.RateLimit != ""
+	var args []string
+	for _, arg := range strings.Fields(c.Aria2cArgs) {
+		switch {
+		case auto && strings.HasPrefix(arg, "--split="):
+			arg = "--split=" + strconv.Itoa(n)
+		case auto && strings.HasPrefix(arg, "--max-connection-per-server="):
+			// aria2c refuses more than 16 connections per server
+			arg = "--max-connection-per-server=" + strconv.Itoa(min(n, 16))
+		case c.PerDownloadLimit != "" && strings.HasPrefix(arg, "--max-download-limit="),
+			overallLimit != "" && strings.HasPrefix(arg, "--max-overall-download-limit="):
+			continue
+		}
+		if limited {
+			for _, prefix := range []string{"--split=", "--max-connection-per-server=", "--max-concurrent-downloads="} {
+				if strings.HasPrefix(arg, prefix) {
+					arg = clampArg(arg, prefix, rateLimitedConnections)
+				}
+			}
+		}
+		args = append(args, arg)
+	}
+	if c.PerDownloadLimit != "" {
+		args = append(args, "--max-download-limit="+c.PerDownloadLimit)
+	}
+	if overallLimit != "" {
+		args = append(args, "--max-overall-download-limit="+overallLimit)
+	}
+	if c.Proxy != "" && !c.SOCKSProxy() {
+		args = append(args, "--all-proxy="+c.Proxy)
+	}
+	return strings.Join(args, " ")
+}
+
+// aria2 speed values: bytes per second with an optional K or M suffix
+var downloadLimitRegex = regexp.MustCompile(`^[0-9]+[KkMm]?$`)
+
+// Checks that PerDownloadLimit, OverallDownloadLimit and RateLimit are speeds both aria2c
+// and yt-dlp accept, like 500K or 2M
+func (c *Config) ValidateDownloadLimits() error {
+	for _, limit := range []string{c.PerDownloadLimit, c.OverallDownloadLimit} {
+		if limit != "" && !downloadLimitRegex.MatchString(limit) {
+			return fmt.Errorf("invalid download limit %q, expected bytes per second like 500K or 2M", limit)
+		}
+	}
+	if c.RateLimit != "" && !downloadLimitRegex.MatchString(c.RateLimit) {
+		return fmt.Errorf("invalid rate limit %q, expected bytes per second like 500K or 2M", c.RateLimit)
+	}
+	return nil
+}
+
+// Picks the output template for the current content type, placing the file in
+// upload date folders when DateFolders is set
+func (c *Config) ActiveOutputTemplate() string {
+	template := c.contentOutputTemplate()
+	if !c.DateFolders {
+		return template
+	}
+	dir, file := path.Split(template)
+	return dir + DateFoldersPrefix + file
+}
+
+// Picks the output template configured for the current content type
+func (c *Config) contentOutputTemplate() string {
+	var candidates []string
+	if c.IsAudioOnly {
+		if c.IsPlaylist {
+			candidates = append(candidates, c.PlaylistAudioOutputTemplate)
+		}
+		candidates = append(candidates, c.AudioOutputTemplate)
+	} else {
+		if c.IsPlaylist {
+			candidates = append(candidates, c.PlaylistVideoOutputTemplate)
+		}
+		candidates = append(candidates, c.VideoOutputTemplate)
+	}
+	for _, template := range candidates {
+		if template != "" {
+			return template
+		}
+	}
+	return c.OutputTemplate
+}
+
+// Matches the NAME part of NAME:ARGS, e.g. "ffmpeg", "Merger+ffmpeg_o" or "ExtractAudio+ffmpeg"
+var postprocessorNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\+[A-Za-z][A-Za-z0-9_]*)?$`)
+
+// Checks that each postprocessor argument has the NAME:ARGS form yt-dlp expects
+func (c *Config) ValidatePostprocessorArgs() error {
+	for _, arg := range c.PostprocessorArgs {
+		name, args, ok := strings.Cut(arg, ":")
+		if !ok || strings.TrimSpace(args) == "" {
+			return fmt.Errorf("invalid postprocessor args %q, expected NAME:ARGS", arg)
+		}
+		if !postprocessorNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid postprocessor name %q in %q", name, arg)
+		}
+	}
+	return nil
+}
+
+// Logs and waits before retrying after the given attempt: RetryDelay doubled for every earlier
+// attempt and capped at MaxRetryDelay, or a longer server-requested wait, plus up to 25% jitter
+// so playlist items don't retry in lockstep. Returns early with ctx's error when it is cancelled.
+func (c *Config) WaitBeforeRetry(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	delay := c.RetryDelay
+	for i := 1; i < attempt && (c.MaxRetryDelay <= 0 || delay < c.MaxRetryDelay); i++ {
+		delay *= 2
+	}
+	if c.MaxRetryDelay > 0 {
+		delay = min(delay, c.MaxRetryDelay)
+	}
+	delay = max(delay, retryAfter)
+	if delay > 0 {
+		delay += time.Duration(rand.Int64N(int64(delay)/4 + 1))
+	}
+	fmt.Fprintf(c.Stdout, "Waiting %v before retrying...\n", delay.Round(100*time.Millisecond))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"yaria/utils"
+)
+
+// Browsers accepted by yt-dlp's --cookies-from-browser
+var SupportedBrowsers = []string{"brave", "chrome", "chromium", "edge", "firefox", "opera", "safari", "vivaldi", "whale"}
+
+// Keyrings accepted by yt-dlp's --cookies-from-browser
+var SupportedKeyrings = []string{"basictext", "gnomekeyring", "kwallet", "kwallet5", "kwallet6"}
+
+// Parsed browser[+keyring][:profile][::container] cookie source
+type CookieBrowserSpec struct {
+	Browser   string
+	Keyring   string
+	Profile   string
+	Container string
+}
+
+// Parses and checks the syntax of a --cookies-from-browser value
+func ParseCookieBrowser(value string) (CookieBrowserSpec, error) {
+	var spec CookieBrowserSpec
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return spec, fmt.Errorf("empty browser name")
+	}
+
+	// Container is separated by "::" and may contain single colons
+	if i := strings.Index(value, "::"); i >= 0 {
+		spec.Container = value[i+2:]
+		value = value[:i]
+		if spec.Container == "" {
+			return spec, fmt.Errorf("empty container name after '::'")
+		}
+	}
+	if i := strings.Index(value, ":"); i >= 0 {
+		spec.Profile = value[i+1:]
+		value = value[:i]
+		if spec.Profile == "" {
+			return spec, fmt.Errorf("empty profile name after ':'")
+		}
+	}
+	if i := strings.Index(value, "+"); i >= 0 {
+		spec.Keyring = strings.ToLower(value[i+1:])
+		value = value[:i]
+		if !contains(SupportedKeyrings, spec.Keyring) {
+			return spec, fmt.Errorf("unsupported keyring %q (valid: %s)", spec.Keyring, strings.Join(SupportedKeyrings, ", "))
+		}
+	}
+
+	spec.Browser = strings.ToLower(value)
+	if !contains(SupportedBrowsers, spec.Browser) {
+		return spec, fmt.Errorf("unsupported browser %q (valid: %s)", spec.Browser, strings.Join(SupportedBrowsers, ", "))
+	}
+	if spec.Container != "" && spec.Browser != "firefox" {
+		return spec, fmt.Errorf("containers are only supported for firefox, not %s", spec.Browser)
+	}
+	return spec, nil
+}
+
+// Formats the spec back into yt-dlp syntax
+func (s CookieBrowserSpec) String() string {
+	out := s.Browser
+	if s.Keyring != "" {
+		out += "+" + s.Keyring
+	}
+	if s.Profile != "" {
+		out += ":" + s.Profile
+	}
+	if s.Container != "" {
+		out += "::" + s.Container
+	}
+	return out
+}
+
+// Checks that CookieFile exists so a typo fails before yt-dlp runs
+func (c *Config) ValidateCookieFile() error {
+	if c.CookieFile == "" {
+		return nil
+	}
+	if !utils.FileExists(c.CookieFile) {
+		return fmt.Errorf("cookies file %s does not exist", c.CookieFile)
+	}
+	return nil
+}
+
+// Validates CookieBrowser, checking the profile and container against those on disk
+func (c *Config) ValidateCookieBrowser() error {
+	if c.CookieBrowser == "" {
+		return nil
+	}
+	spec, err := ParseCookieBrowser(c.CookieBrowser)
+	if err != nil {
+		return fmt.Errorf("invalid cookie browser %q: %v", c.CookieBrowser, err)
+	}
+
+	// Profiles given as paths are used by yt-dlp as-is
+	var profileDirs []string
+	if spec.Profile != "" && isPath(spec.Profile) {
+		if _, err := os.Stat(spec.Profile); err != nil {
+			return fmt.Errorf("%s profile directory %s does not exist", spec.Browser, spec.Profile)
+		}
+		profileDirs = []string{spec.Profile}
+	} else {
+		profiles := BrowserProfiles(spec.Browser)
+		if spec.Profile != "" {
+			// Enumeration is best-effort, only reject when we actually found profiles
+			if len(profiles) > 0 && !contains(profileNames(profiles), spec.Profile) {
+				return fmt.Errorf("%s profile %q not found (available: %s)", spec.Browser, spec.Profile, strings.Join(profileNames(profiles), ", "))
+			}
+			for _, p := range profiles {
+				if filepath.Base(p) == spec.Profile {
+					profileDirs = append(profileDirs, p)
+				}
+			}
+		} else {
+			profileDirs = profiles
+		}
+	}
+
+	if spec.Container != "" && spec.Container != "none" {
+		var containers []string
+		for _, dir := range profileDirs {
+			containers = append(containers, firefoxContainers(dir)...)
+		}
+		if len(containers) > 0 && !contains(containers, spec.Container) {
+			return fmt.Errorf("firefox container %q not found (available: none, %s)", spec.Container, strings.Join(containers, ", "))
+		}
+	}
+	return nil
+}
+
+// Lists profile directories found on disk for a browser
+func BrowserProfiles(browser string) []string {
+	var profiles []string
+	for _, root := range browserRoots(browser) {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			dir := filepath.Join(root, entry.Name())
+			// Firefox profiles hold cookies.sqlite, Chromium profiles hold Preferences
+			if fileExists(filepath.Join(dir, "cookies.sqlite")) || fileExists(filepath.Join(dir, "Preferences")) {
+				profiles = append(profiles, dir)
+			}
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// Returns the directories that hold a browser's profiles
+func browserRoots(browser string) []string {
+	home, _ := os.UserHomeDir()
+	appData := os.Getenv("APPDATA")
+	localAppData := os.Getenv("LOCALAPPDATA")
+
+	switch runtime.GOOS {
+	case "windows":
+		switch browser {
+		case "firefox":
+			return []string{filepath.Join(appData, "Mozilla", "Firefox", "Profiles")}
+		case "chrome":
+			return []string{filepath.Join(localAppData, "Google", "Chrome", "User Data")}
+		case "chromium":
+			return []string{filepath.Join(localAppData, "Chromium", "User Data")}
+		case "brave":
+			return []string{filepath.Join(localAppData, "BraveSoftware", "Brave-Browser", "User Data")}
+		case "edge":
+			return []string{filepath.Join(localAppData, "Microsoft", "Edge", "User Data")}
+		case "opera":
+			return []string{filepath.Join(appData, "Opera Software", "Opera Stable")}
+		case "vivaldi":
+			return []string{filepath.Join(localAppData, "Vivaldi", "User Data")}
+		case "whale":
+			return []string{filepath.Join(localAppData, "Naver", "Naver Whale", "User Data")}
+		}
+	case "darwin":
+		support := filepath.Join(home, "Library", "Application Support")
+		switch browser {
+		case "firefox":
+			return []string{filepath.Join(support, "Firefox", "Profiles")}
+		case "chrome":
+			return []string{filepath.Join(support, "Google", "Chrome")}
+		case "chromium":
+			return []string{filepath.Join(support, "Chromium")}
+		case "brave":
+			return []string{filepath.Join(support, "BraveSoftware", "Brave-Browser")}
+		case "edge":
+			return []string{filepath.Join(support, "Microsoft Edge")}
+		case "opera":
+			return []string{filepath.Join(support, "com.operasoftware.Opera")}
+		case "vivaldi":
+			return []string{filepath.Join(support, "Vivaldi")}
+		case "whale":
+			return []string{filepath.Join(support, "Naver", "Whale")}
+		}
+	default:
+		configDir := filepath.Join(home, ".config")
+		if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+			configDir = xdg
+		}
+		switch browser {
+		case "firefox":
+			return []string{
+				filepath.Join(home, ".mozilla", "firefox"),
+				filepath.Join(home, "snap", "firefox", "common", ".mozilla", "firefox"),
+				filepath.Join(home, ".var", "app", "org.mozilla.firefox", ".mozilla", "firefox"),
+			}
+		case "chrome":
+			return []string{filepath.Join(configDir, "google-chrome")}
+		case "chromium":
+			return []string{filepath.Join(configDir, "chromium")}
+		case "brave":
+			return []string{filepath.Join(configDir, "BraveSoftware", "Brave-Browser")}
+		case "edge":
+			return []string{filepath.Join(configDir, "microsoft-edge")}
+		case "opera":
+			return []string{filepath.Join(configDir, "opera")}
+		case "vivaldi":
+			return []string{filepath.Join(configDir, "vivaldi")}
+		case "whale":
+			return []string{filepath.Join(configDir, "naver-whale")}
+		}
+	}
+	return nil
+}
+
+// Reads container names from a firefox profile's containers.json
+func firefoxContainers(profileDir string) []string {
+	data, err := os.ReadFile(filepath.Join(profileDir, "containers.json"))
+	if err != nil {
+		return nil
+	}
+	var parsed struct {
+		Identities []struct {
+			Name   string `json:"name"`
+			L10nID string `json:"l10nID"`
+			Public bool   `json:"public"`
+		} `json:"identities"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+	var names []string
+	for _, identity := range parsed.Identities {
+		if !identity.Public {
+			continue
+		}
+		name := identity.Name
+		// Built-in containers only carry a label id like "userContextPersonal.label"
+		if name == "" && strings.HasPrefix(identity.L10nID, "userContext") {
+			name = strings.TrimSuffix(strings.TrimPrefix(identity.L10nID, "userContext"), ".label")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Returns the base names of profile directories
+func profileNames(dirs []string) []string {
+	names := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		names = append(names, filepath.Base(dir))
+	}
+	return names
+}
+
+// Reports whether a profile value is a filesystem path rather than a name
+func isPath(value string) bool {
+	return filepath.IsAbs(value) || strings.ContainsAny(value, `/\`)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names checked in each config directory, in order
+var configFileNames = []string{"config.yaml", ".yariarc"}
+
+// Settings that can be persisted in a config file, unset keys keep their defaults
+type fileConfig struct {
+	MaxRetries                  *int           `yaml:"max_retries"`
+	RetryDelay                  *time.Duration `yaml:"retry_delay"`
+	MaxRetryDelay               *time.Duration `yaml:"max_retry_delay"`
+	CommandTimeout              *time.Duration `yaml:"command_timeout"`
+	FormatCacheTTL              *time.Duration `yaml:"format_cache_ttl"`
+	Aria2cArgs                  *string        `yaml:"aria2c_args"`
+	OutputTemplate              *string        `yaml:"output_template"`
+	AudioOutputTemplate         *string        `yaml:"audio_output_template"`
+	VideoOutputTemplate         *string        `yaml:"video_output_template"`
+	PlaylistAudioOutputTemplate *string        `yaml:"playlist_audio_output_template"`
+	PlaylistVideoOutputTemplate *string        `yaml:"playlist_video_output_template"`
+	UseAria2c                   *bool          `yaml:"use_aria2c"`
+	DateFolders                 *bool          `yaml:"date_folders"`
+	OnExisting                  *string        `yaml:"on_existing"`
+	YTDLPPath                   *string        `yaml:"yt_dlp_path"`
+	Proxy                       *string        `yaml:"proxy"`
+	MergeOutputFormat           *string        `yaml:"merge_output_format"`
+	PerDownloadLimit            *string        `yaml:"per_download_limit"`
+	OverallDownloadLimit        *string        `yaml:"overall_download_limit"`
+	RateLimit                   *string        `yaml:"rate_limit"`
+	AudioFormat                 *string        `yaml:"audio_format"`
+	Resolution                  *string        `yaml:"resolution"`
+	DefaultFormat               *string        `yaml:"default_format"`
+	ConcurrentFragments         *string        `yaml:"concurrent_fragments"`
+	CookieBrowser               *string        `yaml:"cookies_from_browser"`
+	CookieFile                  *string        `yaml:"cookies"`
+	DownloadLocation            *string        `yaml:"download_location"`
+	DepsDir                     *string        `yaml:"deps_dir"`
+	GitHubToken                 *string        `yaml:"github_token"`
+
+	AuthTokens map[string]string `yaml:"auth_tokens"` // Host to token
+}
+
+// Loads defaults overridden by the YAML config file at path. Unknown keys are ignored.
+func LoadConfig(path string) (*Config, error) {
+	cfg := defaults()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file fileConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	set(&cfg.MaxRetries, file.MaxRetries)
+	set(&cfg.RetryDelay, file.RetryDelay)
+	set(&cfg.MaxRetryDelay, file.MaxRetryDelay)
+	set(&cfg.CommandTimeout, file.CommandTimeout)
+	set(&cfg.FormatCacheTTL, file.FormatCacheTTL)
+	set(&cfg.Aria2cArgs, file.Aria2cArgs)
+	set(&cfg.OutputTemplate, file.OutputTemplate)
+	set(&cfg.AudioOutputTemplate, file.AudioOutputTemplate)
+	set(&cfg.VideoOutputTemplate, file.VideoOutputTemplate)
+	set(&cfg.PlaylistAudioOutputTemplate, file.PlaylistAudioOutputTemplate)
+	set(&cfg.PlaylistVideoOutputTemplate, file.PlaylistVideoOutputTemplate)
+	set(&cfg.UseAria2c, file.UseAria2c)
+	set(&cfg.DateFolders, file.DateFolders)
+	set(&cfg.OnExisting, file.OnExisting)
+	set(&cfg.YTDLPPath, file.YTDLPPath)
+	set(&cfg.Proxy, file.Proxy)
+	set(&cfg.MergeOutputFormat, file.MergeOutputFormat)
+	set(&cfg.PerDownloadLimit, file.PerDownloadLimit)
+	set(&cfg.OverallDownloadLimit, file.OverallDownloadLimit)
+	set(&cfg.RateLimit, file.RateLimit)
+	set(&cfg.AudioFormat, file.AudioFormat)
+	set(&cfg.Resolution, file.Resolution)
+	set(&cfg.DefaultFormat, file.DefaultFormat)
+	set(&cfg.ConcurrentFragments, file.ConcurrentFragments)
+	set(&cfg.CookieBrowser, file.CookieBrowser)
+	set(&cfg.CookieFile, file.CookieFile)
+	if file.AuthTokens != nil {
+		cfg.AuthTokens = file.AuthTokens
+	}
+	set(&cfg.DownloadLocation, file.DownloadLocation)
+	set(&cfg.DepsDir, file.DepsDir)
+	set(&cfg.GitHubToken, file.GitHubToken)
+	if cfg.MaxRetries < 1 {
+		return nil, fmt.Errorf("%s: max_retries must be at least 1", path)
+	}
+	return cfg, nil
+}
+
+// Overwrites dst when the file set a value
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// Returns the first existing config file in $XDG_CONFIG_HOME/yaria or next to the binary
+func findConfigFile() string {
+	var dirs []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "yaria"))
+	}
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, dir := range dirs {
+		for _, name := range configFileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Loads the config file if one exists, keeping defaults and returning a warning when it's malformed
+func loadDefaultConfig() (*Config, []string) {
+	path := findConfigFile()
+	if path == "" {
+		return defaults(), nil
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return defaults(), []string{fmt.Sprintf("Ignoring config file: %v", err)}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,27 @@
+package downloader
+
+import (
+	"strconv"
+	"strings"
+
+	"yaria/config"
+)
+
+// Returns yt-dlp args that tag an audio playlist as one album, or nil when album mode doesn't apply.
+// Items downloaded on their own lack playlist fields, so album and track are passed as fallbacks.
+func AlbumArgs(cfg *config.Config, album string, track int) []string {
+	if !cfg.AlbumMode || !cfg.IsAudioOnly || !cfg.IsPlaylist {
+		return nil
+	}
+	trackDefault := ""
+	if track > 0 {
+		trackDefault = strconv.Itoa(track)
+	}
+	// --parse-metadata splits FROM:TO on the first unescaped colon
+	album = strings.ReplaceAll(album, ":", `\:`)
+	return []string{
+		"--parse-metadata", "%(playlist_title|" + album + ")s:%(meta_album)s",
+		"--parse-metadata", "%(playlist_index|" + trackDefault + ")s:%(meta_track)s",
+		"--embed-metadata",
+	}
+}
@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"runtime"
+	"strconv"
+
+	"yaria/config"
+)
+
+// Returns the yt-dlp args every download of url takes whatever its format and tuning flags:
+// site access, filenames, postprocessing, speed limits and aria2c as external downloader.
+// bandwidth is the measured speed aria2c's auto fragments are sized by, 0 when unknown.
+func CommonDownloadArgs(cfg *config.Config, url string, bandwidth float64) []string {
+	args := accessArgs(cfg, url)
+	if cfg.TrimFilenames > 0 {
+		args = append(args, "--trim-filenames", strconv.Itoa(cfg.TrimFilenames))
+	}
+	if cfg.WaitForVideo != "" {
+		args = append(args, "--wait-for-video", cfg.WaitForVideo)
+	}
+	if cfg.NoPart {
+		args = append(args, "--no-part")
+	}
+	args = append(args, AudioNormalizeArgs(cfg)...)
+	args = append(args, EmbedArgs(cfg)...)
+	args = append(args, SponsorBlockArgs(cfg)...)
+	args = append(args, MultistreamArgs(cfg)...)
+	args = append(args, MergeArgs(cfg)...)
+	args = append(args, RateLimitArgs(cfg)...)
+	for _, ppa := range cfg.PostprocessorArgs {
+		args = append(args, "--postprocessor-args", ppa)
+	}
+	if cfg.UseAria2c {
+		aria2Cmd := "aria2c"
+		if runtime.GOOS == "windows" {
+			aria2Cmd = "aria2c.exe"
+		}
+		args = append(args, "--downloader", aria2Cmd, "--downloader-args", "aria2c:"+cfg.Aria2cArgsResolved(bandwidth))
+	}
+	return args
+}
@@ -0,0 +1,25 @@
+package downloader
+
+import (
+	"os/exec"
+
+	"yaria/config"
+)
+
+// EBU R128 loudness target common for podcasts and spoken word
+const loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+
+// Reports whether ffmpeg is available for postprocessing
+func HasFFmpeg() bool {
+	_, err := exec.LookPath("ffmpeg")
+	return err == nil
+}
+
+// Returns postprocessor args that normalize loudness while extracting audio, or nil when
+// normalization is off, the download isn't audio only, or ffmpeg is missing
+func AudioNormalizeArgs(cfg *config.Config) []string {
+	if !cfg.AudioNormalize || !cfg.IsAudioOnly || !HasFFmpeg() {
+		return nil
+	}
+	return []string{"--postprocessor-args", "ExtractAudio+ffmpeg_o:-af " + loudnormFilter}
+}
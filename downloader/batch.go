@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"yaria/utils"
+)
+
+// One URL from a batch file, with an optional destination override
+type BatchEntry struct {
+	URL string `json:"url"`
+	Dir string `json:"output,omitempty"`
+}
+
+// Reads a batch file with one entry per line: a bare URL, "url<TAB>output-dir",
+// or a JSON object like {"url": "...", "output": "..."}. Blank lines and lines
+// starting with # or ; are skipped.
+func ReadBatchFile(path string) ([]BatchEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []BatchEntry
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		var entry BatchEntry
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid JSON entry: %v", path, lineNum, err)
+			}
+		} else {
+			url, dir, _ := strings.Cut(line, "\t")
+			entry = BatchEntry{URL: url, Dir: dir}
+		}
+		entry.URL = strings.TrimSpace(entry.URL)
+		entry.Dir = strings.TrimSpace(entry.Dir)
+		if entry.URL == "" {
+			return nil, fmt.Errorf("%s:%d: missing url", path, lineNum)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Roughly checks that s is something yt-dlp can take as a URL: scheme://host,
+// or a scheme-prefixed search like "ytsearch5:query"
+func LooksLikeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	return u.Host != "" || u.Opaque != ""
+}
+
+// Downloads every entry with up to concurrency URLs in flight, returning results in entry order
+func (c *Client) FetchAll(ctx context.Context, entries []BatchEntry, extraArgs []string, defaultDir string, concurrency int) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]Result, len(entries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.fetchEntry(ctx, entries[i], i+1, len(entries), extraArgs, defaultDir, concurrency > 1)
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// Downloads one batch entry, giving it its own config when running alongside others
+func (c *Client) fetchEntry(ctx context.Context, entry BatchEntry, n, total int, extraArgs []string, defaultDir string, parallel bool) Result {
+	destDir := defaultDir
+	if entry.Dir != "" {
+		destDir = utils.ExpandHome(entry.Dir)
+	}
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return Result{URL: entry.URL, Dir: destDir, Err: fmt.Errorf("failed to create %s: %v", destDir, err)}
+	}
+	c.log.Info("Item %d of %d: %s -> %s", n, total, entry.URL, destDir)
+
+	client := c
+	if parallel {
+		// yt-dlp output would interleave, so report progress as one prefixed line per 10%
+		jobCfg := *c.dl.cfg
+		jobCfg.Stdout = io.Discard
+		dl := c.dl.WithConfig(&jobCfg)
+		lastStep := -1
+		dl.SetProgressCallback(func(event ProgressEvent) {
+			if event.Status != ProgressDownloading {
+				return
+			}
+			step := int(event.Percent) / 10
+			if step == lastStep {
+				return
+			}
+			lastStep = step
+			c.log.Info("[%d/%d] %5.1f%% %s/s ETA %s", n, total, event.Percent, FormatBytes(event.Speed), event.ETA.Round(time.Second))
+		})
+		client = NewClient(dl, c.log)
+	}
+	return client.Fetch(ctx, append([]string{entry.URL}, extraArgs...), destDir)
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Throughput measured for one downloader
+type BenchmarkResult struct {
+	Downloader string
+	Bytes      int64
+	Elapsed    time.Duration
+	Err        error
+}
+
+// Bytes per second, 0 when nothing was measured
+func (r BenchmarkResult) Speed() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / r.Elapsed.Seconds()
+}
+
+func (r BenchmarkResult) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("%-7s failed: %v", r.Downloader, r.Err)
+	}
+	return fmt.Sprintf("%-7s %s in %s (%s/s)", r.Downloader, FormatBytes(float64(r.Bytes)),
+		r.Elapsed.Round(100*time.Millisecond), FormatBytes(r.Speed()))
+}
+
+// Downloads url once through aria2c and once with yt-dlp's native downloader into
+// throwaway directories, reporting the throughput of each
+func (d *YTDLPDownloader) Benchmark(ctx context.Context, url string) ([]BenchmarkResult, error) {
+	if !d.cfg.UseAria2c {
+		return nil, errors.New("aria2c is not available, nothing to compare against")
+	}
+	var results []BenchmarkResult
+	for _, useAria2c := range []bool{true, false} {
+		jobCfg := *d.cfg
+		jobCfg.UseAria2c = useAria2c
+		jobCfg.IsPlaylist = false
+		jobCfg.ChaptersFrom = ""
+		jobCfg.ThumbnailID = ""
+		// The user's templates may point outside the throwaway dir, keep both runs inside it
+		jobCfg.OutputTemplate = "%(title)s.%(ext)s"
+		jobCfg.AudioOutputTemplate = ""
+		jobCfg.VideoOutputTemplate = ""
+		jobCfg.PlaylistAudioOutputTemplate = ""
+		jobCfg.PlaylistVideoOutputTemplate = ""
+		jobCfg.DateFolders = false
+		result := BenchmarkResult{Downloader: "native"}
+		if useAria2c {
+			result.Downloader = "aria2c"
+		}
+
+		dir, err := os.MkdirTemp("", "yaria-benchmark-")
+		if err != nil {
+			return results, err
+		}
+		fmt.Fprintf(d.cfg.Stderr, "Benchmarking %s...\n", result.Downloader)
+		start := time.Now()
+		_, result.Err = d.WithConfig(&jobCfg).Download(ctx, []string{url, "--no-playlist"}, dir)
+		result.Elapsed = time.Since(start)
+		result.Bytes = dirSize(dir)
+		os.RemoveAll(dir)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Sums the size of every file under dir
+func dirSize(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chapter sources accepted by Config.ChaptersFrom
+const (
+	ChaptersFromDescription = "description"
+	ChaptersFromComments    = "comments"
+)
+
+// Chapter in the shape of yt-dlp's info JSON
+type Chapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// Matches lines like "00:00 Intro", "[1:02:03] - Outro" or "3. 12:30 Part three"
+var chapterLineRegex = regexp.MustCompile(`^\s*(?:\d+[.)]\s+)?[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*[-–—:|]?\s*(.+?)\s*$`)
+
+// Parses timestamped chapter lines out of free text, ending the last chapter at duration
+func ParseChapters(text string, duration float64) []Chapter {
+	var chapters []Chapter
+	for _, line := range strings.Split(text, "\n") {
+		matches := chapterLineRegex.FindStringSubmatch(line)
+		if len(matches) < 3 {
+			continue
+		}
+		start := parseTimestamp(matches[1])
+		// Timestamps must increase, anything else is a stray time mention
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].StartTime {
+			continue
+		}
+		if duration > 0 && start >= duration {
+			continue
+		}
+		chapters = append(chapters, Chapter{StartTime: start, Title: matches[2]})
+	}
+	// A single timestamp isn't a chapter list
+	if len(chapters) < 2 {
+		return nil
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].EndTime = chapters[i+1].StartTime
+		} else {
+			chapters[i].EndTime = duration
+		}
+	}
+	return chapters
+}
+
+// Converts [h:]mm:ss to seconds
+func parseTimestamp(ts string) float64 {
+	seconds := 0
+	for _, part := range strings.Split(ts, ":") {
+		n, _ := strconv.Atoi(part)
+		seconds = seconds*60 + n
+	}
+	return float64(seconds)
+}
+
+// Adds chapters taken from cfg.ChaptersFrom to info when the video has none,
+// reporting whether any were added
+func (d *YTDLPDownloader) addChapters(info map[string]any) bool {
+	if existing, ok := info["chapters"].([]any); ok && len(existing) > 0 {
+		return false
+	}
+	duration, _ := info["duration"].(float64)
+
+	var chapters []Chapter
+	switch d.cfg.ChaptersFrom {
+	case ChaptersFromDescription:
+		description, _ := info["description"].(string)
+		chapters = ParseChapters(description, duration)
+	case ChaptersFromComments:
+		comments, _ := info["comments"].([]any)
+		for _, c := range comments {
+			comment, _ := c.(map[string]any)
+			text, _ := comment["text"].(string)
+			if chapters = ParseChapters(text, duration); chapters != nil {
+				break
+			}
+		}
+	}
+	if chapters == nil {
+		return false
+	}
+	info["chapters"] = chapters
+	return true
+}
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		ts   string
+		want float64
+	}{
+		{"0:00", 0},
+		{"00:05", 5},
+		{"12:30", 750},
+		{"1:02:03", 3723},
+		{"10:00:00", 36000},
+	}
+	for _, tt := range tests {
+		if got := parseTimestamp(tt.ts); got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %v, want %v", tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestParseChapters(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		duration float64
+		want     []Chapter
+	}{
+		{
+			name:     "plain list",
+			text:     "Tracklist:\n0:00 Intro\n1:30 Verse\n3:45 Outro",
+			duration: 300,
+			want: []Chapter{
+				{StartTime: 0, EndTime: 90, Title: "Intro"},
+				{StartTime: 90, EndTime: 225, Title: "Verse"},
+				{StartTime: 225, EndTime: 300, Title: "Outro"},
+			},
+		},
+		{
+			name:     "brackets, separators and numbering",
+			text:     "1. [0:00] - Start\n2. (59:59) | Middle\n[1:02:03] – End",
+			duration: 4000,
+			want: []Chapter{
+				{StartTime: 0, EndTime: 3599, Title: "Start"},
+				{StartTime: 3599, EndTime: 3723, Title: "Middle"},
+				{StartTime: 3723, EndTime: 4000, Title: "End"},
+			},
+		},
+		{
+			name:     "unsorted stamps are skipped",
+			text:     "0:00 Intro\n5:00 Main\n2:00 see the bit above\n8:00 Outro",
+			duration: 600,
+			want: []Chapter{
+				{StartTime: 0, EndTime: 300, Title: "Intro"},
+				{StartTime: 300, EndTime: 480, Title: "Main"},
+				{StartTime: 480, EndTime: 600, Title: "Outro"},
+			},
+		},
+		{
+			name:     "stamps past the end are skipped",
+			text:     "0:00 Intro\n1:00 Main\n20:00 Bonus",
+			duration: 600,
+			want: []Chapter{
+				{StartTime: 0, EndTime: 60, Title: "Intro"},
+				{StartTime: 60, EndTime: 600, Title: "Main"},
+			},
+		},
+		{name: "single stamp", text: "Best part at 2:15\n2:15 Drop", duration: 300},
+		{name: "no stamps", text: "Thanks for watching!", duration: 300},
+		{name: "empty", duration: 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseChapters(tt.text, tt.duration); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseChapters(%q, %v)\n got  %+v\n want %+v", tt.text, tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddChapters(t *testing.T) {
+	comments := []any{
+		map[string]any{"text": "First!"},
+		map[string]any{"text": "0:00 Intro\n4:10 Solo"},
+		map[string]any{"text": "0:00 Other\n1:00 List"},
+	}
+	tests := []struct {
+		name   string
+		source string
+		info   map[string]any
+		want   []Chapter
+	}{
+		{
+			name:   "description",
+			source: ChaptersFromDescription,
+			info:   map[string]any{"duration": 500.0, "description": "0:00 Intro\n4:10 Solo", "comments": comments},
+			want:   []Chapter{{StartTime: 0, EndTime: 250, Title: "Intro"}, {StartTime: 250, EndTime: 500, Title: "Solo"}},
+		},
+		{
+			name:   "first comment with a list",
+			source: ChaptersFromComments,
+			info:   map[string]any{"duration": 500.0, "description": "0:00 Ignored\n1:00 Here", "comments": comments},
+			want:   []Chapter{{StartTime: 0, EndTime: 250, Title: "Intro"}, {StartTime: 250, EndTime: 500, Title: "Solo"}},
+		},
+		{
+			name:   "no comment with a list",
+			source: ChaptersFromComments,
+			info:   map[string]any{"duration": 500.0, "comments": comments[:1]},
+		},
+		{
+			name:   "existing chapters are kept",
+			source: ChaptersFromDescription,
+			info:   map[string]any{"duration": 500.0, "description": "0:00 Intro\n4:10 Solo", "chapters": []any{map[string]any{"title": "Own"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.ChaptersFrom = tt.source
+			d := &YTDLPDownloader{cfg: cfg}
+			added := d.addChapters(tt.info)
+			if added != (tt.want != nil) {
+				t.Fatalf("addChapters added = %v, want %v", added, tt.want != nil)
+			}
+			if added && !reflect.DeepEqual(tt.info["chapters"], tt.want) {
+				t.Errorf("addChapters chapters\n got  %+v\n want %+v", tt.info["chapters"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Release asset listing the SHA-256 of every other asset, as published by yt-dlp
+const checksumsAsset = "SHA2-256SUMS"
+
+// Returned by releaseChecksum when a release publishes no checksums
+var errNoChecksums = errors.New("release has no " + checksumsAsset)
+
+// Fetches the expected SHA-256 of the asset called name from the release's checksums file
+func releaseChecksum(ctx context.Context, client *http.Client, release *releaseInfo, name string) (string, error) {
+	var sumsURL string
+	for _, asset := range release.Assets {
+		if asset.Name == checksumsAsset {
+			sumsURL = asset.URL
+			break
+		}
+	}
+	if sumsURL == "" {
+		return "", errNoChecksums
+	}
+	sums, err := fetchBytes(ctx, client, sumsURL)
+	if err != nil {
+		return "", err
+	}
+	return checksumFor(sums, name)
+}
+
+// Finds the checksum of name in sha256sum output, lines of "<hex>  <name>" or "<hex> *<name>"
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", name)
+}
+
+// Compares the SHA-256 of the file at path with the expected hex digest,
+// deleting the file when they differ
+func verifyChecksum(path, expected string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		os.Remove(path)
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", path, expected, actual)
+	}
+	return nil
+}
+
+// Like verifyChecksum, but passes when the release published no checksum to compare with
+func verifyChecksumIfKnown(path, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	return verifyChecksum(path, expected)
+}
@@ -0,0 +1,71 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SHA-256 of "hello\n"
+const helloSum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+
+func writeTemp(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	t.Run("match", func(t *testing.T) {
+		path := writeTemp(t, "hello\n")
+		if err := verifyChecksum(path, helloSum); err != nil {
+			t.Fatalf("verifyChecksum() = %v, want nil", err)
+		}
+	})
+	t.Run("uppercase digest", func(t *testing.T) {
+		path := writeTemp(t, "hello\n")
+		if err := verifyChecksum(path, strings.ToUpper(helloSum)); err != nil {
+			t.Fatalf("verifyChecksum() = %v, want nil", err)
+		}
+	})
+	t.Run("mismatch deletes file", func(t *testing.T) {
+		path := writeTemp(t, "tampered\n")
+		if err := verifyChecksum(path, helloSum); err == nil {
+			t.Fatal("verifyChecksum() = nil, want mismatch error")
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("file still exists after mismatch: %v", err)
+		}
+	})
+	t.Run("missing file", func(t *testing.T) {
+		if err := verifyChecksum(filepath.Join(t.TempDir(), "missing"), helloSum); err == nil {
+			t.Fatal("verifyChecksum() = nil, want error")
+		}
+	})
+}
+
+func TestChecksumFor(t *testing.T) {
+	sums := []byte("aaa  yt-dlp.exe\n" + helloSum + "  yt-dlp\nbbb *yt-dlp_macos\n")
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"yt-dlp", helloSum, false},
+		{"yt-dlp.exe", "aaa", false},
+		{"yt-dlp_macos", "bbb", false},
+		{"yt-dlp_linux", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checksumFor(sums, tt.name)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("checksumFor(%q) = %q, %v, want %q (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
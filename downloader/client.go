@@ -0,0 +1,717 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"yaria/config"
+	"yaria/logger"
+	"yaria/utils"
+)
+
+// Outcome of downloading a single URL
+type Result struct {
+	URL        string       `json:"url"`
+	Title      string       `json:"title"`
+	IsPlaylist bool         `json:"isPlaylist"`
+	Type       MediaType    `json:"type,omitempty"`
+	Dir        string       `json:"dir"`
+	Files      []string     `json:"files,omitempty"`
+	Skipped    bool         `json:"skipped,omitempty"`
+	Items      []ItemResult `json:"items,omitempty"`
+	Err        error        `json:"-"`
+}
+
+// Runs the metadata, download and move steps for a URL
+type Client struct {
+	dl  *YTDLPDownloader
+	log logger.Logger
+}
+
+func NewClient(dl *YTDLPDownloader, log logger.Logger) *Client {
+	return &Client{dl: dl, log: log}
+}
+
+// Downloads args (URL followed by extra yt-dlp flags) into destDir. Cancelling ctx stops
+// the download and removes its temp dir, leaving playlist progress in results.json.
+func (c *Client) Fetch(ctx context.Context, args []string, destDir string) Result {
+	result := Result{URL: args[0], Dir: destDir}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	if c.dl.cfg.PreflightCheck {
+		if err := Preflight(c.dl.cfg, args[0]); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	// Plain file links need no extraction, fetch them without yt-dlp
+	if c.dl.cfg.NativeHTTP && IsDirectMediaURL(args[0]) {
+		return c.fetchHTTP(ctx, args[0], destDir, result)
+	}
+
+	playlistInfo, videoTitle, err := c.dl.GetMetadata(ctx, args)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to fetch metadata: %w", err)
+		return result
+	}
+	result.Title = videoTitle
+
+	// Determine playlist or single video
+	parts := utils.SplitN(playlistInfo, "&", 3)
+	if len(parts) < 3 {
+		result.Err = errors.New("invalid metadata format")
+		return result
+	}
+	isPlaylist := parts[0]
+	playlistTitle := parts[1]
+	playlistCountStr := parts[2]
+
+	// Prefer yt-dlp's own classification, falling back to the playlist count
+	mediaType, err := c.dl.GetMediaType(ctx, args[0])
+	if err != nil {
+		c.log.Warn("Warning: %v, guessing from playlist count", err)
+	}
+	result.Type = mediaType
+	// Only the items picked by Config.PlaylistItems count
+	itemCount := PlaylistItemsCount(c.dl.cfg.PlaylistItems, utils.MustParseInt(playlistCountStr))
+	isSingleVideo := treatAsSingle(mediaType, isPlaylist, itemCount)
+	result.IsPlaylist = !isSingleVideo
+	c.dl.cfg.IsPlaylist = result.IsPlaylist
+	if isSingleVideo && (isPlaylist != "NA" || (mediaType != MediaSingle && mediaType != MediaUnknown)) {
+		args = c.soleItemArgs(ctx, args)
+	}
+
+	// Generate final name and check duplicates
+	var finalName, videoFileName, existing string
+	if isSingleVideo {
+		finalName = utils.TrimFilename(utils.SanitizeFilename(videoTitle), c.dl.cfg.TrimFilenames)
+		if finalName == "" {
+			finalName = utils.GenerateTempDirName("Video")
+		}
+		// Ask yt-dlp for the name it will write, so the duplicate check and the move agree
+		videoFileName = finalName + ".mp4"
+		if predicted, err := c.dl.GetOutputFilename(ctx, args, destDir); err == nil {
+			// Relative to destDir, keeping the date folders of DateFolders
+			if videoFileName, err = filepath.Rel(destDir, predicted); err != nil {
+				videoFileName = filepath.Base(predicted)
+			}
+		} else {
+			c.log.Warn("Warning: Could not predict output filename (%v), checking for %s", err, videoFileName)
+		}
+		if existing = existingOutput(destDir, videoFileName); existing != "" {
+			switch c.dl.cfg.OnExisting {
+			case config.OnExistingError:
+				result.Err = fmt.Errorf("%w: %s", ErrFileExists, filepath.Base(existing))
+				return result
+			case config.OnExistingOverwrite:
+				c.log.Warn("Video already exists: %s, downloading it again to overwrite", filepath.Base(existing))
+			case config.OnExistingRename:
+				c.log.Warn("Video already exists: %s, downloading it again under a new name", filepath.Base(existing))
+			default:
+				c.log.Warn("Video already exists: %s, skipping download", filepath.Base(existing))
+				result.Skipped = true
+				result.Files = []string{existing}
+				return result
+			}
+		}
+	} else {
+		result.Title = playlistTitle
+		finalName = utils.TrimFilename(utils.SanitizeFilename(playlistTitle), c.dl.cfg.TrimFilenames)
+		if finalName == "" {
+			finalName = utils.GenerateTempDirName("Playlist")
+		}
+	}
+
+	// Direct mode lets yt-dlp write .part files in place, so interrupted downloads resume.
+	// Replacing or renaming an existing file needs the temp directory's move.
+	if isSingleVideo && c.dl.cfg.DirectDownload && existing == "" {
+		return c.fetchDirect(ctx, args, destDir, result)
+	}
+
+	// Create unique temp directory
+	tempDir, err := utils.CreateUniqueTempDir(filepath.Join(destDir, finalName))
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create directory: %s: %v", tempDir, err)
+		return result
+	}
+	defer func() {
+		if isSingleVideo && utils.FileExists(tempDir) {
+			_ = os.RemoveAll(tempDir)
+		}
+	}()
+
+	if !isSingleVideo {
+		return c.fetchPlaylist(ctx, args, tempDir, result)
+	}
+
+	c.log.Info("Starting download...")
+	success, err := c.dl.Download(ctx, args, tempDir)
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		result.Err = fmt.Errorf("download failed: %w", err)
+		return result
+	}
+	if !success {
+		_ = os.RemoveAll(tempDir)
+		result.Err = ErrDownloadFailed
+		return result
+	}
+
+	// Absolute output templates place files themselves, nothing to move
+	if template := utils.ExpandHome(c.dl.cfg.ActiveOutputTemplate()); filepath.IsAbs(template) {
+		_ = os.RemoveAll(tempDir)
+		result.Dir = filepath.Dir(template)
+		c.log.Info("Download complete. Files saved using output template: %s", template)
+		return result
+	}
+	if len(listFiles(tempDir)) == 0 {
+		c.log.Info(nothingDownloaded)
+		result.Skipped = true
+		return result
+	}
+
+	// Move every media file, a single run can leave more than one behind
+	videoFiles, err := utils.FindMediaFiles(tempDir)
+	if expected := filepath.Join(tempDir, videoFileName); c.dl.cfg.MergeOutputFormat != "" && utils.FileExists(expected) {
+		// A fixed merge format makes the predicted name exact, no need to guess by stem
+		others := slices.DeleteFunc(videoFiles, func(file string) bool { return file == expected })
+		videoFiles = append([]string{expected}, others...)
+	} else if err != nil {
+		c.log.Warn("Warning: No video file found in %s: %v", tempDir, err)
+		return result
+	} else {
+		videoFiles = c.expectedFirst(videoFiles, filepath.Base(videoFileName))
+	}
+	// Subtitles and chat replays aren't media but belong with the video
+	for _, file := range listFiles(tempDir) {
+		if isSidecarFile(file) {
+			videoFiles = append(videoFiles, file)
+		}
+	}
+	for _, videoFile := range videoFiles {
+		// Folders below tempDir, like the date folders of DateFolders, are recreated in destDir
+		dest := filepath.Join(destDir, filepath.Base(videoFile))
+		if rel, err := filepath.Rel(tempDir, videoFile); err == nil {
+			dest = filepath.Join(destDir, rel)
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			c.log.Warn("Warning: Failed to create %s: %v", filepath.Dir(dest), err)
+		} else if dest, err = c.resolveCollision(dest); err != nil {
+			c.log.Warn("Warning: %v, keeping temporary files", err)
+			if c.dl.cfg.OnExisting == config.OnExistingError {
+				result.Err = err
+			}
+		} else if err := checkDestSpace(videoFile, destDir); err != nil {
+			c.log.Warn("Warning: %v, keeping %s in %s", err, filepath.Base(videoFile), tempDir)
+		} else if err := utils.MoveFile(videoFile, dest); err != nil {
+			c.log.Warn("Warning: Failed to move %s (error: %v)", filepath.Base(videoFile), err)
+		} else {
+			c.log.Info("Moved: %s", filepath.Base(videoFile))
+			result.Files = append(result.Files, dest)
+			continue
+		}
+		// Anything left behind keeps the temp dir from being removed
+		isSingleVideo = false
+		result.Dir = tempDir
+		result.Files = append(result.Files, videoFile)
+	}
+	return result
+}
+
+// Applies Config.OnExisting to a move target that is already taken, returning the path to
+// move to. An error means the file must stay where it is.
+func (c *Client) resolveCollision(dest string) (string, error) {
+	if !utils.FileExists(dest) {
+		return dest, nil
+	}
+	switch c.dl.cfg.OnExisting {
+	case config.OnExistingOverwrite:
+		if err := os.Remove(dest); err != nil {
+			return dest, fmt.Errorf("failed to replace %s: %v", filepath.Base(dest), err)
+		}
+		return dest, nil
+	case config.OnExistingRename:
+		return utils.UniquePath(dest), nil
+	default:
+		return dest, fmt.Errorf("%w in destination: %s", ErrFileExists, filepath.Base(dest))
+	}
+}
+
+// Reports whether a URL is handled as one video. A playlist holding a single item counts as
+// one too, so it gets the same naming, duplicate check and move as the video itself.
+func treatAsSingle(mediaType MediaType, isPlaylist string, count int) bool {
+	switch mediaType {
+	case MediaSingle:
+		return true
+	case MediaUnknown:
+		return isPlaylist == "NA" || count <= 1
+	default:
+		return count == 1
+	}
+}
+
+// Swaps a one-item playlist URL in args for the item's own URL, so yt-dlp downloads it
+// without playlist fields in the filename. args are returned unchanged when the item can't be listed.
+func (c *Client) soleItemArgs(ctx context.Context, args []string) []string {
+	entries, err := c.dl.GetPlaylistEntries(ctx, args[0])
+	entries = selectedEntries(entries, c.dl.cfg.PlaylistItems)
+	if err != nil || len(entries) != 1 {
+		c.log.Warn("Warning: Could not resolve the only item of %s, downloading it as a playlist of one", args[0])
+		return args
+	}
+	return append([]string{entries[0].URL}, args[1:]...)
+}
+
+// Returns the entries picked by a --playlist-items spec, all of them when it is empty
+func selectedEntries(entries []PlaylistEntry, spec string) []PlaylistEntry {
+	if spec == "" {
+		return entries
+	}
+	var selected []PlaylistEntry
+	for _, entry := range entries {
+		if PlaylistItemSelected(spec, entry.Index) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// Returns the file in dir matching the predicted path, or a media file with the same stem
+// since merging can change the extension. Empty when there is none.
+func existingOutput(dir, predicted string) string {
+	path := filepath.Join(dir, predicted)
+	if utils.FileExists(path) {
+		return path
+	}
+	dir, predicted = filepath.Split(path)
+	stem := strings.TrimSuffix(predicted, filepath.Ext(predicted))
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && utils.IsMediaFile(name) && strings.TrimSuffix(name, filepath.Ext(name)) == stem {
+			return filepath.Join(dir, name)
+		}
+	}
+	return ""
+}
+
+// Moves the predicted output file to the front of files. When it isn't there, e.g. because
+// merging changed the extension, the file sharing its stem takes its place.
+func (c *Client) expectedFirst(files []string, predicted string) []string {
+	stem := strings.TrimSuffix(predicted, filepath.Ext(predicted))
+	match := -1
+	for i, file := range files {
+		name := filepath.Base(file)
+		if name == predicted {
+			match = i
+			break
+		}
+		if match < 0 && strings.TrimSuffix(name, filepath.Ext(name)) == stem {
+			match = i
+		}
+	}
+	if match < 0 {
+		c.log.Warn("Warning: Predicted output %s not found, moving every media file", predicted)
+		return files
+	}
+	if name := filepath.Base(files[match]); name != predicted {
+		c.log.Info("Output is %s rather than the predicted %s", name, predicted)
+	}
+	return append([]string{files[match]}, append(files[:match:match], files[match+1:]...)...)
+}
+
+// Checks that destDir's filesystem has room for file, skipping the check when the move is a rename
+func checkDestSpace(file, destDir string) error {
+	if utils.SameFilesystem(file, destDir) {
+		return nil
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	free, err := utils.FreeSpace(destDir)
+	if err != nil {
+		// Unknown free space shouldn't block the move
+		return nil
+	}
+	if uint64(info.Size()) > free {
+		return fmt.Errorf("not enough space in %s (%s free, %s needed)", destDir,
+			FormatBytes(float64(free)), FormatBytes(float64(info.Size())))
+	}
+	return nil
+}
+
+// Downloads a direct media link with the native HTTP downloader
+func (c *Client) fetchHTTP(ctx context.Context, url, destDir string, result Result) Result {
+	c.log.Info("Starting native download...")
+	file, err := c.dl.DownloadHTTP(ctx, url, destDir)
+	if err != nil {
+		result.Err = fmt.Errorf("download failed: %w", err)
+		return result
+	}
+	result.Title = filepath.Base(file)
+	result.Type = MediaSingle
+	result.Files = []string{file}
+	c.log.Info("Download complete: %s", file)
+	return result
+}
+
+// Downloads a single video straight into destDir without a temp dir or move
+func (c *Client) fetchDirect(ctx context.Context, args []string, destDir string, result Result) Result {
+	before := make(map[string]bool)
+	for _, file := range listFiles(destDir) {
+		before[file] = true
+	}
+
+	c.log.Info("Starting download...")
+	success, err := c.dl.Download(ctx, args, destDir)
+	if err == nil && !success {
+		err = ErrDownloadFailed
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("download failed: %w", err)
+		return result
+	}
+
+	// Report only files that appeared during this download
+	for _, file := range listFiles(destDir) {
+		if !before[file] {
+			result.Files = append(result.Files, file)
+		}
+	}
+	if len(result.Files) == 0 {
+		c.log.Info(nothingDownloaded)
+		result.Skipped = true
+		return result
+	}
+	c.log.Info("Download complete. Files saved in: %s", destDir)
+	return result
+}
+
+// Downloads a playlist item by item into dir, recording each outcome in results.json
+func (c *Client) fetchPlaylist(ctx context.Context, args []string, dir string, result Result) Result {
+	result.Dir = dir
+	entries, err := c.dl.GetPlaylistEntries(ctx, args[0])
+	if err != nil || len(entries) == 0 {
+		// Without an item list, let yt-dlp handle the whole playlist in one pass
+		c.log.Warn("Warning: Could not list playlist items (%v), downloading in one pass", err)
+		c.log.Info("Starting download...")
+		onePassArgs := append(args, AlbumArgs(c.dl.cfg, result.Title, 0)...)
+		success, err := c.dl.Download(ctx, append(onePassArgs, SleepArgs(c.dl.cfg)...), dir)
+		if err == nil && !success {
+			err = ErrDownloadFailed
+		}
+		if err != nil {
+			result.Err = fmt.Errorf("download failed: %w", err)
+			return result
+		}
+		result.Files = listFiles(dir)
+		if len(result.Files) == 0 {
+			// Don't leave an empty playlist folder behind
+			_ = os.Remove(dir)
+			result.Dir = filepath.Dir(dir)
+			c.log.Info(nothingDownloaded)
+			result.Skipped = true
+			return result
+		}
+		c.log.Info("Playlist download complete. Files in: %s", dir)
+		return result
+	}
+
+	run := &RunLog{URL: args[0], Title: result.Title, StartedAt: time.Now()}
+	for _, entry := range selectedEntries(entries, c.dl.cfg.PlaylistItems) {
+		run.Items = append(run.Items, ItemResult{
+			Index:    entry.Index,
+			URL:      entry.URL,
+			Title:    entry.Title,
+			Duration: entry.Duration,
+			Status:   ItemPending,
+		})
+	}
+	logPath := filepath.Join(dir, ResultsFileName)
+	c.saveRunLog(logPath, run)
+
+	c.log.Info("Starting download of %d playlist items...", len(run.Items))
+	failed, err := c.downloadItems(ctx, run, dir, logPath, args[1:], false)
+
+	result.Items = run.Items
+	result.Files = listFiles(dir)
+	c.writeM3U(dir, run)
+	if err != nil {
+		result.Err = fmt.Errorf("%w, see %s", err, logPath)
+		return result
+	}
+	if failed > 0 {
+		result.Err = fmt.Errorf("%d of %d %w, see %s", failed, len(run.Items), ErrItemsFailed, logPath)
+		return result
+	}
+	if len(result.Files) == 0 {
+		c.log.Info(nothingDownloaded)
+		result.Skipped = true
+		return result
+	}
+	c.log.Info("Playlist download complete. Files in: %s", dir)
+	return result
+}
+
+// Re-attempts the failed items recorded in a previous run's results.json
+func (c *Client) RetryFailed(ctx context.Context, logPath string, extraArgs []string) Result {
+	run, err := ReadRunLog(logPath)
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to read results log %s: %v", logPath, err)}
+	}
+	dir := filepath.Dir(logPath)
+	result := Result{URL: run.URL, Title: run.Title, IsPlaylist: true, Dir: dir}
+
+	pending := 0
+	for _, item := range run.Items {
+		if item.Status != ItemSuccess {
+			pending++
+		}
+	}
+	if pending == 0 {
+		c.log.Info("No failed items to retry in %s", logPath)
+		result.Items = run.Items
+		result.Files = listFiles(dir)
+		return result
+	}
+
+	c.log.Info("Retrying %d of %d playlist items...", pending, len(run.Items))
+	failed, err := c.downloadItems(ctx, run, dir, logPath, extraArgs, true)
+
+	result.Items = run.Items
+	result.Files = listFiles(dir)
+	c.writeM3U(dir, run)
+	if err != nil {
+		result.Err = fmt.Errorf("%w, see %s", err, logPath)
+		return result
+	}
+	if failed > 0 {
+		result.Err = fmt.Errorf("%d of %d retried %w again, see %s", failed, pending, ErrItemsFailed, logPath)
+		return result
+	}
+	c.log.Info("All failed items downloaded. Files in: %s", dir)
+	return result
+}
+
+// Downloads run items into dir, saving the log after each, and returns the failure count.
+// Stops with ErrTooManyFailures once Config.MaxFailStreak items fail in a row,
+// leaving the rest pending for --retry-failed. Cancelling ctx stops the same way.
+func (c *Client) downloadItems(ctx context.Context, run *RunLog, dir, logPath string, extraArgs []string, onlyFailed bool) (int, error) {
+	failed := 0
+	consecutive := 0
+	for i := range run.Items {
+		item := &run.Items[i]
+		if onlyFailed && item.Status == ItemSuccess {
+			continue
+		}
+		c.log.Info("Downloading item %d of %d: %s", item.Index, len(run.Items), item.Title)
+		before := make(map[string]bool)
+		for _, file := range listFiles(dir) {
+			before[file] = true
+		}
+		itemArgs := append([]string{item.URL}, extraArgs...)
+		itemArgs = append(itemArgs, AlbumArgs(c.dl.cfg, run.Title, item.Index)...)
+		itemArgs = append(itemArgs, SleepArgs(c.dl.cfg)...)
+		success, err := c.dl.Download(ctx, itemArgs, dir)
+		if ctx.Err() != nil {
+			// The interrupted item stays pending rather than counting as a failure
+			return failed, ctx.Err()
+		}
+		if err == nil && !success {
+			err = ErrDownloadFailed
+		}
+		if err != nil {
+			failed++
+			item.Status = ItemFailed
+			item.Error = err.Error()
+			c.log.Warn("Warning: Item %d (%s) failed: %v", item.Index, item.Title, err)
+			consecutive++
+		} else {
+			consecutive = 0
+			item.Status = ItemSuccess
+			item.Error = ""
+			if file := largestNewFile(dir, before); file != "" {
+				if item.File, err = filepath.Rel(dir, file); err != nil {
+					item.File = filepath.Base(file)
+				}
+			} else {
+				c.log.Info("Item %d: nothing downloaded, already present or filtered", item.Index)
+			}
+		}
+		c.saveRunLog(logPath, run)
+		if limit := c.dl.cfg.MaxFailStreak; limit > 0 && consecutive >= limit {
+			// Failing in a row usually means expired cookies or a ban, not bad items
+			c.log.Error("Aborting: too many consecutive failures (%d)", consecutive)
+			return failed, fmt.Errorf("%w (%d in a row)", ErrTooManyFailures, consecutive)
+		}
+	}
+	return failed, nil
+}
+
+// Returned when the output file exists and Config.OnExisting doesn't allow replacing it
+var ErrFileExists = errors.New("video already exists")
+
+// Logged when yt-dlp succeeds without writing anything, e.g. because of --download-archive,
+// --match-filter or items already present. Such results count as skipped, not failed.
+const nothingDownloaded = "Nothing to download; all items already present or filtered"
+
+// Returned when every attempt at downloading a URL failed
+var ErrDownloadFailed = errors.New("all download attempts failed")
+
+// Returned when some items of a playlist or retry run failed
+var ErrItemsFailed = errors.New("playlist items failed")
+
+// Returned when a playlist run stops after Config.MaxFailStreak failures in a row
+var ErrTooManyFailures = errors.New("aborting: too many consecutive failures")
+
+// Writes <playlist>.m3u8 next to the items when enabled
+func (c *Client) writeM3U(dir string, run *RunLog) {
+	if !c.dl.cfg.WriteM3U {
+		return
+	}
+	path := filepath.Join(dir, utils.SanitizeFilename(filepath.Base(dir))+".m3u8")
+	if err := WriteM3U(path, run.Items); err != nil {
+		c.log.Warn("Warning: Failed to write %s: %v", path, err)
+		return
+	}
+	c.log.Info("Wrote playlist file: %s", path)
+}
+
+// Returns the largest file in dir not present in before, which is the media rather than subtitles or thumbnails
+func largestNewFile(dir string, before map[string]bool) string {
+	var largest string
+	var largestSize int64 = -1
+	for _, file := range listFiles(dir) {
+		if before[file] {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.Size() > largestSize {
+			largest, largestSize = file, info.Size()
+		}
+	}
+	return largest
+}
+
+// Writes the results log, warning instead of failing the run
+func (c *Client) saveRunLog(path string, run *RunLog) {
+	if err := WriteRunLog(path, run); err != nil {
+		c.log.Warn("Warning: Failed to write %s: %v", path, err)
+	}
+}
+
+// Depth of the YYYY/MM folders written with DateFolders
+const dateFoldersDepth = 2
+
+// Lists downloaded files in dir and the date folders below it, leaving out the results log
+func listFiles(dir string) []string {
+	var files []string
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dir && strings.Count(path[len(dir):], string(filepath.Separator)) > dateFoldersDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() != ResultsFileName && filepath.Ext(entry.Name()) != ".m3u8" && !utils.IsPartialFile(entry.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// Catalog entry written for each item in metadata-only mode
+type CatalogEntry struct {
+	Index     int        `json:"index"`
+	URL       string     `json:"url"`
+	Info      *VideoInfo `json:"info,omitempty"`
+	Thumbnail string     `json:"thumbnail,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Writes info and thumbnail for every item into a catalog directory without downloading media
+func (c *Client) Catalog(ctx context.Context, url string, destDir string) Result {
+	result := Result{URL: url, Dir: destDir}
+
+	playlistInfo, videoTitle, err := c.dl.GetMetadata(ctx, []string{url})
+	if err != nil {
+		result.Err = fmt.Errorf("failed to fetch metadata: %v", err)
+		return result
+	}
+	result.Title = videoTitle
+	parts := utils.SplitN(playlistInfo, "&", 3)
+	result.IsPlaylist = len(parts) == 3 && parts[0] != "NA" && utils.MustParseInt(parts[2]) > 1
+
+	entries := []PlaylistEntry{{Index: 1, URL: url, Title: videoTitle}}
+	if result.IsPlaylist {
+		result.Title = parts[1]
+		entries, err = c.dl.GetPlaylistEntries(ctx, url)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	name := utils.TrimFilename(utils.SanitizeFilename(result.Title), c.dl.cfg.TrimFilenames)
+	catalogDir, err := utils.CreateUniqueTempDir(filepath.Join(destDir, name+"_catalog"))
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create directory: %s: %v", catalogDir, err)
+		return result
+	}
+	result.Dir = catalogDir
+
+	failed := 0
+	for i, entry := range entries {
+		c.log.Info("Cataloging item %d of %d: %s", i+1, len(entries), entry.Title)
+		item := CatalogEntry{Index: entry.Index, URL: entry.URL}
+		baseName := fmt.Sprintf("%03d", entry.Index)
+
+		info, err := c.dl.GetInfo(ctx, entry.URL)
+		if err != nil {
+			failed++
+			item.Error = err.Error()
+			c.log.Warn("Warning: Item %d failed: %v", entry.Index, err)
+		} else {
+			item.Info = info
+			baseName += "_" + utils.SanitizeFilename(info.ID)
+			// Thumbnails land under a fixed name, rename each before fetching the next
+			if thumb, _ := c.dl.GetThumbnail(ctx, []string{entry.URL}, catalogDir); thumb != "" {
+				dest := filepath.Join(catalogDir, baseName+filepath.Ext(thumb))
+				if err := os.Rename(thumb, dest); err == nil {
+					item.Thumbnail = filepath.Base(dest)
+				}
+			}
+		}
+
+		data, _ := json.MarshalIndent(item, "", "  ")
+		path := filepath.Join(catalogDir, baseName+".json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			c.log.Warn("Warning: Failed to write %s: %v", path, err)
+			continue
+		}
+		result.Files = append(result.Files, path)
+	}
+
+	if failed > 0 {
+		result.Err = fmt.Errorf("%d of %d items could not be cataloged", failed, len(entries))
+		return result
+	}
+	c.log.Info("Catalog complete. Files in: %s", catalogDir)
+	return result
+}
@@ -0,0 +1,29 @@
+package downloader
+
+import "testing"
+
+func TestTreatAsSingle(t *testing.T) {
+	tests := []struct {
+		name       string
+		mediaType  MediaType
+		isPlaylist string
+		count      int
+		want       bool
+	}{
+		{"single video", MediaSingle, "NA", 1, true},
+		{"playlist of one", MediaPlaylist, "PL123", 1, true},
+		{"playlist of several", MediaPlaylist, "PL123", 5, false},
+		{"playlist with unknown count", MediaPlaylist, "PL123", 0, false},
+		{"channel of one", MediaChannel, "UC123", 1, true},
+		{"unknown type, no playlist", MediaUnknown, "NA", 1, true},
+		{"unknown type, playlist of one", MediaUnknown, "PL123", 1, true},
+		{"unknown type, playlist of several", MediaUnknown, "PL123", 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := treatAsSingle(tt.mediaType, tt.isPlaylist, tt.count); got != tt.want {
+				t.Errorf("treatAsSingle(%q, %q, %d) = %v, want %v", tt.mediaType, tt.isPlaylist, tt.count, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"yaria/config"
+)
+
+// Returns the yt-dlp cookie args for cfg, preferring a cookies file over browser cookies
+func CookieArgs(cfg *config.Config) []string {
+	if cfg.CookieFile != "" {
+		return []string{"--cookies", cfg.CookieFile}
+	}
+	if cfg.CookieBrowser != "" {
+		return []string{"--cookies-from-browser", cfg.CookieBrowser}
+	}
+	return nil
+}
+
+// Returned when yt-dlp still asks for a login although cookies were given
+var ErrCookiesInvalid = errors.New("your cookies appear expired or invalid, re-export them or log in again in the browser")
+
+// yt-dlp messages meaning the site didn't accept the login, lowercased
+var cookieErrorMarkers = []string{
+	"cookies are no longer valid",
+	"sign in to confirm",
+	"sign in if you've been granted access",
+	"login required",
+	"requires login",
+	"use --cookies-from-browser or --cookies",
+	"age-restricted",
+	"failed to decrypt",
+}
+
+// Returns ErrCookiesInvalid naming the cookie source when cookies are set in cfg and
+// yt-dlp output says they didn't log in, nil otherwise. Retrying with them won't help.
+func CookieError(cfg *config.Config, output string) error {
+	source := cfg.CookieFile
+	if source == "" && cfg.CookieBrowser != "" {
+		source = cfg.CookieBrowser + " browser cookies"
+	}
+	if source == "" {
+		return nil
+	}
+	lower := strings.ToLower(output)
+	for _, marker := range cookieErrorMarkers {
+		if strings.Contains(lower, marker) {
+			return fmt.Errorf("%w (%s)", ErrCookiesInvalid, source)
+		}
+	}
+	return nil
+}
+
+// Returns the args every yt-dlp run against rawURL needs to reach it like the download
+// does: cookies, proxy, auth header and browser impersonation
+func accessArgs(cfg *config.Config, rawURL string) []string {
+	args := CookieArgs(cfg)
+	args = append(args, ProxyArgs(cfg)...)
+	args = append(args, AuthArgs(cfg, rawURL)...)
+	if cfg.Impersonate != "" {
+		args = append(args, "--impersonate", cfg.Impersonate)
+	}
+	return args
+}
+
+// Returns an Authorization header for rawURL's host from cfg.AuthTokens, or nil when none matches.
+// Hosts also match their subdomains, the most specific entry wins. Tokens without a scheme are
+// sent as Bearer tokens.
+func AuthArgs(cfg *config.Config, rawURL string) []string {
+	if len(cfg.AuthTokens) == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	matched, token := "", ""
+	for h, t := range cfg.AuthTokens {
+		h = strings.ToLower(strings.TrimPrefix(h, "."))
+		if (host == h || strings.HasSuffix(host, "."+h)) && len(h) > len(matched) {
+			matched, token = h, t
+		}
+	}
+	if token == "" {
+		return nil
+	}
+	if !strings.Contains(token, " ") {
+		token = "Bearer " + token
+	}
+	return []string{"--add-header", "Authorization:" + token}
+}
+
+// Returns the URL at the front of yt-dlp args, or "" when there is none
+func urlArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+// Moves the URL at the front of yt-dlp args behind "--" at the end, so a URL
+// starting with "-" is never read as an option. Nothing may be appended after it.
+func urlLast(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	return append(append(slices.Clone(args[1:]), "--"), args[0])
+}
@@ -0,0 +1,584 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"yaria/config"
+	"yaria/utils"
+
+	"github.com/google/go-github/v62/github"
+)
+
+// Result of installDependencies, which only needs to run once per process
+var (
+	dependenciesOnce sync.Once
+	dependenciesErr  error
+)
+
+// Makes sure yt-dlp and the optional helpers are installed, fetching missing or outdated ones
+// from GitHub (outdated ones are looked for every 24 hours) and adding the dependencies folder
+// to PATH. The work happens once per process; each call still turns off aria2c in cfg when it is
+// missing or can't follow a SOCKS Config.Proxy.
+// Cancelling ctx stops a download in progress, leaving any older binary in place.
+func EnsureDependencies(ctx context.Context, cfg *config.Config) error {
+	dependenciesOnce.Do(func() {
+		dependenciesErr = installDependencies(ctx, cfg)
+	})
+	if dependenciesErr != nil {
+		return dependenciesErr
+	}
+	if _, err := exec.LookPath(YTDLPCommand(cfg)); err != nil {
+		return errors.New("yt-dlp not installed")
+	}
+	if _, err := exec.LookPath(binaryName("aria2c")); err != nil {
+		cfg.UseAria2c = false
+	}
+	// Checked after installing, which may have turned aria2c on, so it never bypasses the proxy
+	if cfg.SOCKSProxy() && cfg.UseAria2c {
+		fmt.Fprintf(cfg.Stderr, "Warning: aria2c can't use SOCKS proxies, downloading without it\n")
+		cfg.UseAria2c = false
+	}
+	return nil
+}
+
+// Runs path --version, giving up after Config.CommandTimeout or once ctx is done so a hung
+// binary can't block startup
+func versionOutput(ctx context.Context, cfg *config.Config, path string, combined bool) ([]byte, error) {
+	if cfg.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.CommandTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, path, "--version")
+	cmd.WaitDelay = killWaitDelay
+	if combined {
+		return cmd.CombinedOutput()
+	}
+	return cmd.Output()
+}
+
+// Returns the yt-dlp to run: Config.YTDLPPath when set, otherwise the one found on PATH
+func YTDLPCommand(cfg *config.Config) string {
+	if cfg.YTDLPPath != "" {
+		return cfg.YTDLPPath
+	}
+	return binaryName("yt-dlp")
+}
+
+// Adds the suffix executables have on Windows
+func binaryName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// Fetches missing or outdated dependencies into the dependencies folder and puts it on PATH
+func installDependencies(ctx context.Context, cfg *config.Config) error {
+	depsDir := utils.ResolveDepsDir(cfg.DepsDir)
+	if err := os.MkdirAll(depsDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create dependencies directory: %v", err)
+	}
+	if cfg.ForceUpdate {
+		forgetVersionChecks(depsDir, cfg.Stderr)
+	}
+	client := dependencyClient(cfg)
+
+	// Version checks are tracked per binary so one failing lookup doesn't delay the other
+	shouldCheckYTDLP := versionCheckDue(depsDir, "yt-dlp", cfg.Stderr)
+	shouldCheckAria2 := versionCheckDue(depsDir, "aria2", cfg.Stderr)
+
+	// Check and download yt-dlp
+	ytDlpBinary := binaryName("yt-dlp")
+	ytDlpPath := filepath.Join(depsDir, ytDlpBinary)
+	shouldDownloadYTDLP := false
+	if cfg.YTDLPPath != "" {
+		fmt.Fprintf(cfg.Stderr, "Using yt-dlp at %s\n", cfg.YTDLPPath)
+	} else if _, err := exec.LookPath(ytDlpBinary); err != nil {
+		if _, err := os.Stat(ytDlpPath); err != nil {
+			shouldDownloadYTDLP = true
+		} else if shouldCheckYTDLP {
+			// Check yt-dlp version
+			localVersion, err := versionOutput(ctx, cfg, ytDlpPath, false)
+			if err != nil {
+				fmt.Fprintf(cfg.Stderr, "Warning: Failed to check yt-dlp version: %v\n", err)
+				shouldDownloadYTDLP = true
+			} else {
+				release, err := latestRelease(ctx, depsDir, "yt-dlp", "yt-dlp", cfg)
+				if err != nil {
+					return fmt.Errorf("failed to fetch yt-dlp release: %w", err)
+				}
+				latestVersion := strings.TrimPrefix(release.Tag, "v")
+				localVersionStr := strings.TrimSpace(string(localVersion))
+				if localVersionStr != latestVersion {
+					fmt.Fprintf(cfg.Stderr, "Local yt-dlp version %s is outdated, latest is %s\n", localVersionStr, latestVersion)
+					shouldDownloadYTDLP = true
+				} else {
+					fmt.Fprintf(cfg.Stderr, "Found yt-dlp in dependencies at %s (version %s)\n", ytDlpPath, localVersionStr)
+					markVersionChecked(depsDir, "yt-dlp", cfg.Stderr)
+				}
+			}
+		} else {
+			fmt.Fprintf(cfg.Stderr, "Found yt-dlp in dependencies at %s\n", ytDlpPath)
+		}
+	} else {
+		fmt.Fprintf(cfg.Stderr, "Found yt-dlp in system PATH\n")
+	}
+
+	if shouldDownloadYTDLP {
+		fmt.Fprintf(cfg.Stderr, "Downloading yt-dlp from GitHub...\n")
+		release, err := latestRelease(ctx, depsDir, "yt-dlp", "yt-dlp", cfg)
+		if err != nil {
+			return fmt.Errorf("failed to fetch yt-dlp release: %w", err)
+		}
+		var downloadURL string
+		for _, asset := range release.Assets {
+			if asset.Name == ytDlpBinary {
+				downloadURL = asset.URL
+				break
+			}
+		}
+		if downloadURL == "" {
+			return errors.New("no suitable yt-dlp binary found")
+		}
+		expectedSum, err := releaseChecksum(ctx, client, release, ytDlpBinary)
+		if err != nil {
+			return fmt.Errorf("failed to fetch yt-dlp checksum: %w", err)
+		}
+		if err := fetchFile(ctx, client, downloadURL, ytDlpPath); err != nil {
+			return fmt.Errorf("failed to download yt-dlp: %w", err)
+		}
+		if err := verifyChecksum(ytDlpPath, expectedSum); err != nil {
+			return fmt.Errorf("downloaded yt-dlp failed verification: %v", err)
+		}
+		if runtime.GOOS != "windows" {
+			if err := os.Chmod(ytDlpPath, 0o755); err != nil {
+				return fmt.Errorf("failed to set permissions for yt-dlp: %v", err)
+			}
+		}
+		// Smoke test the binary so arch/libc mismatches fail here instead of mid-download
+		if out, err := versionOutput(ctx, cfg, ytDlpPath, true); err != nil {
+			os.Remove(ytDlpPath)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("downloaded yt-dlp is not runnable on this system: %v (%s)", err, strings.TrimSpace(string(out)))
+		}
+		fmt.Fprintf(cfg.Stderr, "Downloaded yt-dlp to %s\n", ytDlpPath)
+		markVersionChecked(depsDir, "yt-dlp", cfg.Stderr)
+	}
+
+	// Check and download aria2
+	aria2Binary := binaryName("aria2c")
+	aria2Path := filepath.Join(depsDir, aria2Binary)
+	shouldDownloadAria2 := false
+	// An outdated but working aria2 stays in use when fetching its update fails before replacing it
+	keepInstalledAria2 := false
+	if cfg.QueryOnly {
+		// Nothing will be downloaded, don't look for or fetch aria2
+		cfg.UseAria2c = false
+	} else if !cfg.UseAria2c {
+		// Turned off by the user, don't look for or fetch aria2
+	} else if _, err := exec.LookPath(aria2Binary); err != nil {
+		if _, err := os.Stat(aria2Path); err != nil {
+			shouldDownloadAria2 = true
+		} else if shouldCheckAria2 {
+			// Check aria2 version
+			localVersion, err := versionOutput(ctx, cfg, aria2Path, false)
+			if err != nil {
+				fmt.Fprintf(cfg.Stderr, "Warning: Failed to check aria2 version: %v\n", err)
+				shouldDownloadAria2 = true
+			} else {
+				release, err := latestRelease(ctx, depsDir, "aria2", "aria2", cfg)
+				if err != nil {
+					// The installed aria2 still works, keep using it
+					fmt.Fprintf(cfg.Stderr, "Warning: Failed to fetch aria2 release: %v\n", err)
+				} else {
+					latestVersion := strings.TrimPrefix(release.Tag, "release-")
+					localVersionStr := strings.TrimSpace(string(localVersion))
+					if strings.Contains(localVersionStr, "aria2 ") {
+						localVersionStr = strings.Split(localVersionStr, " ")[1]
+					}
+					if localVersionStr != latestVersion {
+						fmt.Fprintf(cfg.Stderr, "Local aria2 version %s is outdated, latest is %s\n", localVersionStr, latestVersion)
+						shouldDownloadAria2 = true
+						keepInstalledAria2 = true
+					} else {
+						fmt.Fprintf(cfg.Stderr, "Found aria2 in dependencies at %s (version %s)\n", aria2Path, localVersionStr)
+						markVersionChecked(depsDir, "aria2", cfg.Stderr)
+					}
+				}
+			}
+		} else {
+			fmt.Fprintf(cfg.Stderr, "Found aria2 in dependencies at %s\n", aria2Path)
+		}
+	} else {
+		fmt.Fprintf(cfg.Stderr, "Found aria2 in system PATH\n")
+	}
+
+	if shouldDownloadAria2 {
+		fmt.Fprintf(cfg.Stderr, "Downloading aria2 from GitHub...\n")
+		release, err := latestRelease(ctx, depsDir, "aria2", "aria2", cfg)
+		if err != nil {
+			fmt.Fprintf(cfg.Stderr, "Warning: Failed to fetch aria2 release: %v\n", err)
+			cfg.UseAria2c = keepInstalledAria2
+		} else {
+			assetPattern := fmt.Sprintf("aria2-[0-9.]+-%s-%s", runtime.GOOS, runtime.GOARCH)
+			var downloadURL, assetName string
+			for _, asset := range release.Assets {
+				if strings.Contains(asset.Name, assetPattern) && !strings.Contains(asset.Name, ".tar.") && !strings.Contains(asset.Name, ".zip") {
+					downloadURL, assetName = asset.URL, asset.Name
+					break
+				}
+			}
+			// aria2 is optional and doesn't always publish checksums, so a missing list only warns
+			var expectedSum string
+			var sumErr error
+			if downloadURL != "" {
+				expectedSum, sumErr = releaseChecksum(ctx, client, release, assetName)
+				if errors.Is(sumErr, errNoChecksums) {
+					fmt.Fprintf(cfg.Stderr, "Warning: aria2 release publishes no checksums, installing it unverified\n")
+					sumErr = nil
+				}
+			}
+			if downloadURL == "" {
+				fmt.Fprintf(cfg.Stderr, "Warning: No suitable aria2 binary found\n")
+				cfg.UseAria2c = keepInstalledAria2
+			} else if sumErr != nil {
+				fmt.Fprintf(cfg.Stderr, "Warning: Failed to fetch aria2 checksum: %v\n", sumErr)
+				cfg.UseAria2c = keepInstalledAria2
+			} else {
+				if err := fetchFile(ctx, client, downloadURL, aria2Path); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					fmt.Fprintf(cfg.Stderr, "Warning: Failed to download aria2: %v\n", err)
+					cfg.UseAria2c = keepInstalledAria2
+				} else if err := verifyChecksumIfKnown(aria2Path, expectedSum); err != nil {
+					fmt.Fprintf(cfg.Stderr, "Warning: Downloaded aria2 failed verification: %v\n", err)
+					cfg.UseAria2c = false
+				} else if runtime.GOOS != "windows" {
+					if err := os.Chmod(aria2Path, 0o755); err != nil {
+						fmt.Fprintf(cfg.Stderr, "Warning: Failed to set permissions for aria2: %v\n", err)
+						cfg.UseAria2c = false
+					} else {
+						fmt.Fprintf(cfg.Stderr, "Downloaded aria2 to %s\n", aria2Path)
+						markVersionChecked(depsDir, "aria2", cfg.Stderr)
+					}
+				} else {
+					fmt.Fprintf(cfg.Stderr, "Downloaded aria2 to %s\n", aria2Path)
+					markVersionChecked(depsDir, "aria2", cfg.Stderr)
+				}
+			}
+		}
+	}
+
+	// Check and download deno for JavaScript challenge solving
+	denoBinary := binaryName("deno")
+	denoPath := filepath.Join(depsDir, denoBinary)
+	if _, err := exec.LookPath(denoBinary); err != nil {
+		if _, err := os.Stat(denoPath); err != nil {
+			fmt.Fprintf(cfg.Stderr, "Downloading deno for JavaScript challenge solving...\n")
+			// Determine platform-specific download URL
+			var denoURL string
+			switch runtime.GOOS {
+			case "linux":
+				denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-unknown-linux-gnu.zip"
+			case "darwin":
+				if runtime.GOARCH == "arm64" {
+					denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-aarch64-apple-darwin.zip"
+				} else {
+					denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-apple-darwin.zip"
+				}
+			case "windows":
+				denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-pc-windows-msvc.zip"
+			default:
+				fmt.Fprintf(cfg.Stderr, "Warning: Unsupported platform for deno auto-install. JavaScript challenges may fail.\n")
+			}
+
+			if denoURL != "" {
+				// Save zip file temporarily
+				zipPath := filepath.Join(depsDir, "deno.zip")
+				if err := fetchFile(ctx, client, denoURL, zipPath); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					fmt.Fprintf(cfg.Stderr, "Warning: Failed to download deno: %v. JavaScript challenges may fail.\n", err)
+				} else if err := extractDenoFromZip(zipPath, denoPath); err != nil {
+					// Extract deno binary from zip
+					fmt.Fprintf(cfg.Stderr, "Warning: Failed to extract deno: %v\n", err)
+				} else {
+					os.Remove(zipPath)
+					if runtime.GOOS != "windows" {
+						os.Chmod(denoPath, 0o755)
+					}
+					fmt.Fprintf(cfg.Stderr, "Downloaded deno to %s\n", denoPath)
+				}
+			}
+		} else {
+			fmt.Fprintf(cfg.Stderr, "Found deno in dependencies at %s\n", denoPath)
+		}
+	} else {
+		fmt.Fprintf(cfg.Stderr, "Found deno in system PATH\n")
+	}
+
+	// Check and download yazi for file explorer integration (optional)
+	yaziBinary := binaryName("yazi")
+	yaziPath := filepath.Join(depsDir, yaziBinary)
+	if _, err := exec.LookPath(yaziBinary); err != nil {
+		if _, err := os.Stat(yaziPath); err != nil {
+			fmt.Fprintf(cfg.Stderr, "Downloading yazi for file explorer (optional)...\n")
+			// Yazi download URLs - using specific version for stability
+			var yaziURL string
+			switch runtime.GOOS {
+			case "linux":
+				yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-unknown-linux-gnu.zip"
+			case "darwin":
+				if runtime.GOARCH == "arm64" {
+					yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-aarch64-apple-darwin.zip"
+				} else {
+					yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-apple-darwin.zip"
+				}
+			case "windows":
+				yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-pc-windows-msvc.zip"
+			}
+
+			if yaziURL != "" {
+				zipPath := filepath.Join(depsDir, "yazi.zip")
+				if err := fetchFile(ctx, client, yaziURL, zipPath); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+				} else if err := extractYaziFromZip(zipPath, yaziPath); err == nil {
+					// Extract yazi binary
+					os.Remove(zipPath)
+					if runtime.GOOS != "windows" {
+						os.Chmod(yaziPath, 0o755)
+					}
+					fmt.Fprintf(cfg.Stderr, "Downloaded yazi to %s\n", yaziPath)
+				}
+			}
+		}
+	}
+
+	// Install webtorrent-cli for torrent streaming support
+	webtorrentBinary := "webtorrent"
+	if runtime.GOOS == "windows" {
+		webtorrentBinary = "webtorrent.cmd"
+	}
+
+	// Check if webtorrent-cli is available
+	webtorrentInstalled := false
+	if _, err := exec.LookPath("webtorrent"); err == nil {
+		webtorrentInstalled = true
+		fmt.Fprintf(cfg.Stderr, "Found webtorrent-cli in system PATH\n")
+	} else {
+		// Check in dependencies folder
+		webtorrentPath := filepath.Join(depsDir, "bin", webtorrentBinary)
+		if _, err := os.Stat(webtorrentPath); err == nil {
+			webtorrentInstalled = true
+			fmt.Fprintf(cfg.Stderr, "Found webtorrent-cli in dependencies\n")
+		}
+	}
+
+	if !webtorrentInstalled {
+		fmt.Fprintf(cfg.Stderr, "Installing webtorrent-cli for torrent streaming...\n")
+
+		// Use npm for installation (deno has issues with Node-API addons)
+		if _, err := exec.LookPath("npm"); err == nil {
+			fmt.Fprintf(cfg.Stderr, "Installing webtorrent-cli via npm...\n")
+
+			// Install to dependencies folder
+			installCmd := exec.Command("npm", "install", "-g", "--prefix", depsDir, "webtorrent-cli")
+			installCmd.Stdout = cfg.Stderr
+			installCmd.Stderr = cfg.Stderr
+			err := installCmd.Run()
+			if err == nil {
+				fmt.Fprintf(cfg.Stderr, "Installed webtorrent-cli successfully\n")
+				webtorrentInstalled = true
+			} else {
+				fmt.Fprintf(cfg.Stderr, "npm install failed: %v\n", err)
+			}
+		} else {
+			fmt.Fprintf(cfg.Stderr, "npm not found, skipping webtorrent-cli installation\n")
+		}
+
+		if !webtorrentInstalled {
+			fmt.Fprintf(cfg.Stderr, "Warning: webtorrent-cli installation failed. Torrent streaming will not be available.\n")
+			fmt.Fprintf(cfg.Stderr, "You can install it manually: npm install -g webtorrent-cli\n")
+		}
+	}
+
+	// Update PATH to include dependencies folder and bin directory
+	currentPath := os.Getenv("PATH")
+	binDir := filepath.Join(depsDir, "bin")
+	// Append so binaries already in PATH, often newer, aren't shadowed by bundled copies
+	newPath := currentPath + string(os.PathListSeparator) + depsDir + string(os.PathListSeparator) + binDir
+	if cfg.PreferBundled {
+		newPath = depsDir + string(os.PathListSeparator) + binDir + string(os.PathListSeparator) + currentPath
+	}
+	if err := os.Setenv("PATH", newPath); err != nil {
+		return fmt.Errorf("failed to update PATH: %v", err)
+	}
+
+	return nil
+}
+
+// Binaries of the dependencies New keeps up to date, by the name their checks are tracked under
+var dependencyBinaries = map[string]string{"yt-dlp": "yt-dlp", "aria2": "aria2c"}
+
+// Reports the version of a dependency ("yt-dlp" or "aria2") as New would find it
+// with depsDir, empty when it isn't installed
+func DependencyVersion(depsDir, name string) string {
+	binary := binaryName(dependencyBinaries[name])
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		path = filepath.Join(depsDir, binary)
+	}
+	output, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	// aria2c prints "aria2 version X" followed by build details
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// Drops the last check times and cached releases so the next checks ask GitHub right away
+func forgetVersionChecks(depsDir string, stderr io.Writer) {
+	for name := range dependencyBinaries {
+		for _, file := range []string{"last_check_" + name, "release_" + name + ".json"} {
+			if err := os.Remove(filepath.Join(depsDir, file)); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(stderr, "Warning: Failed to reset %s version check: %v\n", name, err)
+			}
+		}
+	}
+}
+
+// Reports whether a binary's version check is due (every 24 hours)
+func versionCheckDue(depsDir, name string, stderr io.Writer) bool {
+	info, err := os.Stat(filepath.Join(depsDir, "last_check_"+name))
+	if err != nil || time.Since(info.ModTime()) >= 24*time.Hour {
+		return true
+	}
+	fmt.Fprintf(stderr, "Skipping %s version check, last checked at %s\n", name, info.ModTime().Format(time.RFC3339))
+	return false
+}
+
+// Records a successful version check for a binary
+func markVersionChecked(depsDir, name string, stderr io.Writer) {
+	if f, err := os.Create(filepath.Join(depsDir, "last_check_"+name)); err != nil {
+		fmt.Fprintf(stderr, "Warning: Failed to update %s last_check timestamp: %v\n", name, err)
+	} else {
+		f.Close()
+	}
+}
+
+// Latest release of a dependency as cached in release_<name>.json
+type releaseInfo struct {
+	Tag       string         `json:"tag"`
+	Assets    []releaseAsset `json:"assets"`
+	CheckedAt time.Time      `json:"checked_at"`
+}
+
+// Downloadable file attached to a release
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Returns the latest GitHub release of owner/repo, served from the cache within the check window
+// and falling back to a stale cache when the API is unreachable
+func latestRelease(ctx context.Context, depsDir, owner, repo string, cfg *config.Config) (*releaseInfo, error) {
+	stderr := cfg.Stderr
+	cachePath := filepath.Join(depsDir, "release_"+repo+".json")
+	var cached *releaseInfo
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var info releaseInfo
+		if json.Unmarshal(data, &info) == nil && info.Tag != "" {
+			cached = &info
+		}
+	}
+	if cached != nil && time.Since(cached.CheckedAt) < 24*time.Hour {
+		return cached, nil
+	}
+
+	release, _, err := gitHubClient(cfg).Repositories.GetLatestRelease(ctx, owner, repo)
+	if err != nil {
+		err = gitHubError(err)
+		if cached == nil {
+			return nil, err
+		}
+		fmt.Fprintf(stderr, "Warning: Failed to fetch %s release (%v), using cached %s from %s\n",
+			repo, err, cached.Tag, cached.CheckedAt.Format(time.RFC3339))
+		return cached, nil
+	}
+
+	info := &releaseInfo{Tag: release.GetTagName(), CheckedAt: time.Now()}
+	for _, asset := range release.Assets {
+		info.Assets = append(info.Assets, releaseAsset{Name: asset.GetName(), URL: asset.GetBrowserDownloadURL()})
+	}
+	if data, err := json.Marshal(info); err == nil {
+		if err := os.WriteFile(cachePath, data, 0o644); err != nil {
+			fmt.Fprintf(stderr, "Warning: Failed to cache %s release info: %v\n", repo, err)
+		}
+	}
+	return info, nil
+}
+
+// Environment variable holding a GitHub token, taking precedence over Config.GitHubToken
+const gitHubTokenEnv = "GITHUB_TOKEN"
+
+// Client for release lookups, built once so the access mode is reported once
+var (
+	gitHubOnce      sync.Once
+	gitHubAPIClient *github.Client
+)
+
+// Returns the GitHub client for release lookups, authenticated when a token is set
+// so shared IPs don't run into the anonymous limit of 60 requests an hour
+func gitHubClient(cfg *config.Config) *github.Client {
+	gitHubOnce.Do(func() {
+		token := os.Getenv(gitHubTokenEnv)
+		if token == "" {
+			token = cfg.GitHubToken
+		}
+		gitHubAPIClient = github.NewClient(dependencyClient(cfg))
+		if token != "" {
+			gitHubAPIClient = gitHubAPIClient.WithAuthToken(token)
+			fmt.Fprintf(cfg.Stderr, "Using authenticated GitHub API access\n")
+		} else {
+			fmt.Fprintf(cfg.Stderr, "Using anonymous GitHub API access\n")
+		}
+	})
+	return gitHubAPIClient
+}
+
+// Rewords GitHub rate limit errors to say when they lift and how to avoid them
+func gitHubError(err error) error {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return fmt.Errorf("GitHub API rate limit exceeded until %s, set %s to raise it",
+			rateErr.Rate.Reset.Format(time.Kitchen), gitHubTokenEnv)
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return fmt.Errorf("GitHub API secondary rate limit hit, wait a few minutes or set %s", gitHubTokenEnv)
+	}
+	return err
+}
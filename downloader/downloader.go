@@ -2,464 +2,307 @@ package downloader
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"yaria/config"
-
-	"github.com/google/go-github/v62/github"
+	"yaria/utils"
 )
 
 // Interface for yt-dlp operations
 type Downloader interface {
-	GetMetadata(args []string) (string, string, error)
-	GetOutputFilename(args []string, tempDir string) (string, error)
-	GetFormats(url string) ([]Format, error)
-	GetThumbnail(args []string, tempDir string) (string, error)
-	Download(args []string, tempDir string) (bool, error)
+	GetMetadata(ctx context.Context, args []string) (string, string, error)
+	GetOutputFilename(ctx context.Context, args []string, tempDir string) (string, error)
+	GetFormats(ctx context.Context, url string) ([]Format, error)
+	GetThumbnail(ctx context.Context, args []string, tempDir string) (string, error)
+	GetPlaylistEntries(ctx context.Context, url string) ([]PlaylistEntry, error)
+	GetMediaType(ctx context.Context, url string) (MediaType, error)
+	Download(ctx context.Context, args []string, tempDir string) (bool, error)
+}
+
+// yt-dlp flags that only query information and never download media
+var queryOnlyFlags = []string{
+	"--print", "-O", "--simulate", "-s", "--skip-download",
+	"--dump-json", "-j", "--dump-single-json", "-J",
+	"--list-formats", "-F", "--list-subs", "--list-thumbnails",
+	"--get-title", "-e", "--get-id", "--get-url", "-g", "--get-duration", "--get-filename",
+}
+
+// Reports whether yt-dlp args only query information, so no downloader is needed
+func IsQueryOnly(args []string) bool {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		for _, flag := range queryOnlyFlags {
+			if name == flag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// How long to wait for output pipes after killing yt-dlp, children like ffmpeg or aria2c
+// can hold them open
+const killWaitDelay = 2 * time.Second
+
+// Returned when a yt-dlp query runs past Config.CommandTimeout
+var ErrCommandTimeout = errors.New("yt-dlp did not respond in time, the site may be stalling or blocking this region")
+
+// Runs a yt-dlp query bounded by ctx and Config.CommandTimeout, returning its stdout,
+// or stdout and stderr when combined is set. Running out of time returns ErrCommandTimeout.
+func (d *YTDLPDownloader) runQuery(ctx context.Context, combined bool, args ...string) ([]byte, error) {
+	ytDlpCmd := YTDLPCommand(d.cfg)
+	queryCtx := ctx
+	if d.cfg.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		queryCtx, cancel = context.WithTimeout(ctx, d.cfg.CommandTimeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(queryCtx, ytDlpCmd, args...)
+	cmd.WaitDelay = killWaitDelay
+	var output []byte
+	var err error
+	if combined {
+		output, err = cmd.CombinedOutput()
+	} else {
+		output, err = cmd.Output()
+	}
+	if ctx.Err() != nil {
+		return output, ctx.Err()
+	}
+	if errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+		return output, fmt.Errorf("%w (no answer after %s)", ErrCommandTimeout, d.cfg.CommandTimeout)
+	}
+	return output, err
+}
+
+// Returned when the video is a premiere or live event that hasn't started
+var ErrUpcomingVideo = errors.New("this video is a scheduled premiere or live event that hasn't started yet")
+
+// Reports whether yt-dlp output says the video hasn't started yet
+func IsUpcomingError(output string) bool {
+	return strings.Contains(output, "Premieres in") ||
+		strings.Contains(output, "Premiere will begin") ||
+		strings.Contains(output, "live event will begin")
+}
+
+// Returned when yt-dlp has no extractor for the URL
+var ErrUnsupportedURL = errors.New("Invalid or unsupported URL. Please check the URL and try again")
+
+// Returned when yt-dlp reports that the content is DRM-protected
+var ErrDRMProtected = errors.New("this content is DRM-protected and cannot be downloaded")
+
+// Reports whether yt-dlp output mentions DRM protection
+func IsDRMError(output string) bool {
+	lower := strings.ToLower(output)
+	return strings.Contains(lower, "drm protected") ||
+		strings.Contains(lower, "drm-protected") ||
+		strings.Contains(lower, "known to use drm")
 }
 
 // Represents video/audio format
 type Format struct {
+	ID         string
+	Height     int
+	Ext        string
+	IsAudio    bool
+	Protocol   string
+	FileSize   string
+	FPS        int     // 0 when unknown or audio
+	Codec      string  // Short codec name, e.g. "vp9", "avc1+mp4a" for muxed formats or "opus" for audio
+	VCodec     string  // Full video codec, e.g. "avc1.640028", empty for audio
+	ACodec     string  // Full audio codec, e.g. "mp4a.40.2", empty for video only
+	SizeBytes  int64   // Exact or approximate size in bytes, 0 when unknown
+	SizeApprox bool    // SizeBytes is yt-dlp's estimate from the bitrate
+	TBR        float64 // Total bitrate in KBit/s, 0 when unknown
+}
+
+// Represents a single item of a playlist
+type PlaylistEntry struct {
+	Index    int
 	ID       string
-	Height   int
-	Ext      string
-	IsAudio  bool
-	Protocol string
-	FileSize string
+	URL      string
+	Title    string
+	Duration float64
+}
+
+// Kind of content a URL points at
+type MediaType string
+
+const (
+	MediaUnknown  MediaType = ""
+	MediaSingle   MediaType = "single"
+	MediaPlaylist MediaType = "playlist"
+	MediaChannel  MediaType = "channel"
+	MediaTab      MediaType = "tab" // One tab of a channel, e.g. /videos or /shorts
+)
+
+// Channel tab suffixes yt-dlp lists as separate playlists
+var channelTabs = []string{"/videos", "/shorts", "/streams", "/live", "/playlists", "/podcasts", "/releases", "/featured"}
+
+// Subset of yt-dlp's info JSON used for catalogs
+type VideoInfo struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Uploader    string  `json:"uploader,omitempty"`
+	Channel     string  `json:"channel,omitempty"`
+	Duration    float64 `json:"duration,omitempty"`
+	UploadDate  string  `json:"upload_date,omitempty"`
+	ViewCount   int64   `json:"view_count,omitempty"`
+	WebpageURL  string  `json:"webpage_url"`
+	Thumbnail   string  `json:"thumbnail,omitempty"`
+	Description string  `json:"description,omitempty"`
 }
 
 // Implements the Downloader interface
 type YTDLPDownloader struct {
-	cfg *config.Config
+	cfg        *config.Config
+	onProgress func(ProgressEvent)
+	// Heights of the formats last listed by GetFormats, keyed by format ID
+	formatHeights map[string]int
+	formats       *formatCache
+	bandwidth     *bandwidthSample
+	// Info JSON fetched by GetOutputFilename for the info JSON rewrite, keyed by URL
+	infoMu      sync.Mutex
+	fetchedInfo map[string][]byte
 }
 
 func New(cfg *config.Config) (*YTDLPDownloader, error) {
-	// Create dependencies folder in a persistent location
-	var depsDir string
-
-	// Try to use user's home directory for dependencies
-	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		// Use ~/.yaria/dependencies for persistent storage
-		depsDir = filepath.Join(homeDir, ".yaria", "dependencies")
-	} else {
-		// Fallback to current working directory
-		cwd, _ := os.Getwd()
-		depsDir = filepath.Join(cwd, "dependencies")
-	}
-
-	if err := os.MkdirAll(depsDir, 0o755); err != nil {
-		return nil, fmt.Errorf("failed to create dependencies directory: %v", err)
+	if err := EnsureDependencies(context.Background(), cfg); err != nil {
+		return nil, err
 	}
+	return &YTDLPDownloader{cfg: cfg, formats: newFormatCache(), bandwidth: &bandwidthSample{}}, nil
+}
 
-	// Check if version check is needed (every 24 hours)
-	lastCheckFile := filepath.Join(depsDir, "last_check")
-	shouldCheckVersions := true
-	if info, err := os.Stat(lastCheckFile); err == nil {
-		if time.Since(info.ModTime()) < 24*time.Hour {
-			shouldCheckVersions = false
-			fmt.Fprintf(cfg.Stderr, "Skipping version check, last checked at %s\n", info.ModTime().Format(time.RFC3339))
-		}
-	}
+// Returns a downloader sharing the installed dependencies but using cfg
+func (d *YTDLPDownloader) WithConfig(cfg *config.Config) *YTDLPDownloader {
+	return &YTDLPDownloader{cfg: cfg, onProgress: d.onProgress, formatHeights: d.formatHeights, formats: d.formats, bandwidth: d.bandwidth}
+}
 
-	// Initialize GitHub client
-	var client *github.Client
-	if shouldCheckVersions {
-		client = github.NewClient(nil)
-	}
+// Registers a callback invoked for each progress update during Download
+func (d *YTDLPDownloader) SetProgressCallback(callback func(ProgressEvent)) {
+	d.onProgress = callback
+}
 
-	// Check and download yt-dlp
-	ytDlpBinary := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpBinary = "yt-dlp.exe"
-	}
-	ytDlpPath := filepath.Join(depsDir, ytDlpBinary)
-	shouldDownloadYTDLP := false
-	if _, err := exec.LookPath(ytDlpBinary); err != nil {
-		if _, err := os.Stat(ytDlpPath); err != nil {
-			shouldDownloadYTDLP = true
-		} else if shouldCheckVersions {
-			// Check yt-dlp version
-			cmd := exec.Command(ytDlpPath, "--version")
-			localVersion, err := cmd.Output()
-			if err != nil {
-				fmt.Fprintf(cfg.Stderr, "Warning: Failed to check yt-dlp version: %v\n", err)
-				shouldDownloadYTDLP = true
-			} else {
-				release, _, err := client.Repositories.GetLatestRelease(context.Background(), "yt-dlp", "yt-dlp")
-				if err != nil {
-					return nil, fmt.Errorf("failed to fetch yt-dlp release: %v", err)
-				}
-				latestVersion := strings.TrimPrefix(release.GetTagName(), "v")
-				localVersionStr := strings.TrimSpace(string(localVersion))
-				if localVersionStr != latestVersion {
-					fmt.Fprintf(cfg.Stderr, "Local yt-dlp version %s is outdated, latest is %s\n", localVersionStr, latestVersion)
-					shouldDownloadYTDLP = true
-				} else {
-					fmt.Fprintf(cfg.Stderr, "Found yt-dlp in dependencies at %s (version %s)\n", ytDlpPath, localVersionStr)
-				}
-			}
-		} else {
-			fmt.Fprintf(cfg.Stderr, "Found yt-dlp in dependencies at %s\n", ytDlpPath)
-		}
-	} else {
-		fmt.Fprintf(cfg.Stderr, "Found yt-dlp in system PATH\n")
+// Returns the writer for yt-dlp's stdout, reporting progress when a callback is set
+// and feeding the size guard when one is given
+func (d *YTDLPDownloader) stdout(guard *sizeGuard) io.Writer {
+	autoFragments := d.cfg.ConcurrentFragments == config.AutoFragments
+	if d.onProgress == nil && guard == nil && !autoFragments {
+		return d.cfg.Stdout
 	}
-
-	if shouldDownloadYTDLP {
-		fmt.Fprintf(cfg.Stderr, "Downloading yt-dlp from GitHub...\n")
-		if client == nil {
-			client = github.NewClient(nil)
-		}
-		release, _, err := client.Repositories.GetLatestRelease(context.Background(), "yt-dlp", "yt-dlp")
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch yt-dlp release: %v", err)
-		}
-		var downloadURL string
-		for _, asset := range release.Assets {
-			if asset.GetName() == ytDlpBinary {
-				downloadURL = asset.GetBrowserDownloadURL()
-				break
-			}
-		}
-		if downloadURL == "" {
-			return nil, errors.New("no suitable yt-dlp binary found")
-		}
-		resp, err := http.Get(downloadURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download yt-dlp: %v", err)
+	return newProgressWriter(d.cfg.Stdout, func(event ProgressEvent) {
+		if guard != nil {
+			guard.check(event)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to download yt-dlp: HTTP status %s", resp.Status)
+		// Later downloads this session size their fragments from the measured speed
+		if autoFragments {
+			d.bandwidth.record(event.Speed)
 		}
-		if err := os.Remove(ytDlpPath); err != nil && !os.IsNotExist(err) {
-			fmt.Fprintf(cfg.Stderr, "Warning: Failed to remove outdated yt-dlp: %v\n", err)
+		if d.onProgress != nil {
+			d.onProgress(event)
 		}
-		out, err := os.Create(ytDlpPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create yt-dlp binary: %v", err)
-		}
-		_, err = io.Copy(out, resp.Body)
-		out.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to save yt-dlp: %v", err)
-		}
-		if runtime.GOOS != "windows" {
-			if err := os.Chmod(ytDlpPath, 0o755); err != nil {
-				return nil, fmt.Errorf("failed to set permissions for yt-dlp: %v", err)
-			}
-		}
-		fmt.Fprintf(cfg.Stderr, "Downloaded yt-dlp to %s\n", ytDlpPath)
-	}
-
-	// Check and download aria2
-	aria2Binary := "aria2c"
-	if runtime.GOOS == "windows" {
-		aria2Binary = "aria2c.exe"
-	}
-	aria2Path := filepath.Join(depsDir, aria2Binary)
-	shouldDownloadAria2 := false
-	if _, err := exec.LookPath(aria2Binary); err != nil {
-		if _, err := os.Stat(aria2Path); err != nil {
-			shouldDownloadAria2 = true
-		} else if shouldCheckVersions {
-			// Check aria2 version
-			cmd := exec.Command(aria2Path, "--version")
-			localVersion, err := cmd.Output()
-			if err != nil {
-				fmt.Fprintf(cfg.Stderr, "Warning: Failed to check aria2 version: %v\n", err)
-				shouldDownloadAria2 = true
-			} else {
-				release, _, err := client.Repositories.GetLatestRelease(context.Background(), "aria2", "aria2")
-				if err != nil {
-					fmt.Fprintf(cfg.Stderr, "Warning: Failed to fetch aria2 release: %v\n", err)
-					cfg.UseAria2c = false
-				} else {
-					latestVersion := strings.TrimPrefix(release.GetTagName(), "release-")
-					localVersionStr := strings.TrimSpace(string(localVersion))
-					if strings.Contains(localVersionStr, "aria2 ") {
-						localVersionStr = strings.Split(localVersionStr, " ")[1]
-					}
-					if localVersionStr != latestVersion {
-						fmt.Fprintf(cfg.Stderr, "Local aria2 version %s is outdated, latest is %s\n", localVersionStr, latestVersion)
-						shouldDownloadAria2 = true
-					} else {
-						fmt.Fprintf(cfg.Stderr, "Found aria2 in dependencies at %s (version %s)\n", aria2Path, localVersionStr)
-						cfg.UseAria2c = true
-					}
-				}
-			}
-		} else {
-			fmt.Fprintf(cfg.Stderr, "Found aria2 in dependencies at %s\n", aria2Path)
-			cfg.UseAria2c = true
-		}
-	} else {
-		fmt.Fprintf(cfg.Stderr, "Found aria2 in system PATH\n")
-		cfg.UseAria2c = true
-	}
-
-	if shouldDownloadAria2 {
-		fmt.Fprintf(cfg.Stderr, "Downloading aria2 from GitHub...\n")
-		if client == nil {
-			client = github.NewClient(nil)
-		}
-		release, _, err := client.Repositories.GetLatestRelease(context.Background(), "aria2", "aria2")
-		if err != nil {
-			fmt.Fprintf(cfg.Stderr, "Warning: Failed to fetch aria2 release: %v\n", err)
-			cfg.UseAria2c = false
-		} else {
-			assetPattern := fmt.Sprintf("aria2-[0-9.]+-%s-%s", runtime.GOOS, runtime.GOARCH)
-			var downloadURL string
-			for _, asset := range release.Assets {
-				if strings.Contains(asset.GetName(), assetPattern) && !strings.Contains(asset.GetName(), ".tar.") && !strings.Contains(asset.GetName(), ".zip") {
-					downloadURL = asset.GetBrowserDownloadURL()
-					break
-				}
-			}
-			if downloadURL == "" {
-				fmt.Fprintf(cfg.Stderr, "Warning: No suitable aria2 binary found\n")
-				cfg.UseAria2c = false
-			} else {
-				resp, err := http.Get(downloadURL)
-				if err != nil {
-					fmt.Fprintf(cfg.Stderr, "Warning: Failed to download aria2: %v\n", err)
-					cfg.UseAria2c = false
-				} else {
-					defer resp.Body.Close()
-					if resp.StatusCode != http.StatusOK {
-						fmt.Fprintf(cfg.Stderr, "Warning: Failed to download aria2: HTTP status %s\n", resp.Status)
-						cfg.UseAria2c = false
-					} else {
-						if err := os.Remove(aria2Path); err != nil && !os.IsNotExist(err) {
-							fmt.Fprintf(cfg.Stderr, "Warning: Failed to remove outdated aria2: %v\n", err)
-						}
-						out, err := os.Create(aria2Path)
-						if err != nil {
-							fmt.Fprintf(cfg.Stderr, "Warning: Failed to create aria2 binary: %v\n", err)
-							cfg.UseAria2c = false
-						} else {
-							_, err = io.Copy(out, resp.Body)
-							out.Close()
-							if err != nil {
-								fmt.Fprintf(cfg.Stderr, "Warning: Failed to save aria2: %v\n", err)
-								cfg.UseAria2c = false
-							} else if runtime.GOOS != "windows" {
-								if err := os.Chmod(aria2Path, 0o755); err != nil {
-									fmt.Fprintf(cfg.Stderr, "Warning: Failed to set permissions for aria2: %v\n", err)
-									cfg.UseAria2c = false
-								} else {
-									fmt.Fprintf(cfg.Stderr, "Downloaded aria2 to %s\n", aria2Path)
-									cfg.UseAria2c = true
-								}
-							} else {
-								fmt.Fprintf(cfg.Stderr, "Downloaded aria2 to %s\n", aria2Path)
-								cfg.UseAria2c = true
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	// Check and download deno for JavaScript challenge solving
-	denoBinary := "deno"
-	if runtime.GOOS == "windows" {
-		denoBinary = "deno.exe"
-	}
-	denoPath := filepath.Join(depsDir, denoBinary)
-	if _, err := exec.LookPath(denoBinary); err != nil {
-		if _, err := os.Stat(denoPath); err != nil {
-			fmt.Fprintf(cfg.Stderr, "Downloading deno for JavaScript challenge solving...\n")
-			// Determine platform-specific download URL
-			var denoURL string
-			switch runtime.GOOS {
-			case "linux":
-				denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-unknown-linux-gnu.zip"
-			case "darwin":
-				if runtime.GOARCH == "arm64" {
-					denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-aarch64-apple-darwin.zip"
-				} else {
-					denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-apple-darwin.zip"
-				}
-			case "windows":
-				denoURL = "https://github.com/denoland/deno/releases/latest/download/deno-x86_64-pc-windows-msvc.zip"
-			default:
-				fmt.Fprintf(cfg.Stderr, "Warning: Unsupported platform for deno auto-install. JavaScript challenges may fail.\n")
-			}
+	})
+}
 
-			if denoURL != "" {
-				resp, err := http.Get(denoURL)
-				if err != nil {
-					fmt.Fprintf(cfg.Stderr, "Warning: Failed to download deno: %v. JavaScript challenges may fail.\n", err)
-				} else {
-					defer resp.Body.Close()
-					if resp.StatusCode == http.StatusOK {
-						// Save zip file temporarily
-						zipPath := filepath.Join(depsDir, "deno.zip")
-						zipFile, err := os.Create(zipPath)
-						if err == nil {
-							_, err = io.Copy(zipFile, resp.Body)
-							zipFile.Close()
-							if err == nil {
-								// Extract deno binary from zip
-								if err := extractDenoFromZip(zipPath, denoPath); err != nil {
-									fmt.Fprintf(cfg.Stderr, "Warning: Failed to extract deno: %v\n", err)
-								} else {
-									os.Remove(zipPath)
-									if runtime.GOOS != "windows" {
-										os.Chmod(denoPath, 0o755)
-									}
-									fmt.Fprintf(cfg.Stderr, "Downloaded deno to %s\n", denoPath)
-								}
-							}
-						}
-					}
-				}
-			}
-		} else {
-			fmt.Fprintf(cfg.Stderr, "Found deno in dependencies at %s\n", denoPath)
-		}
-	} else {
-		fmt.Fprintf(cfg.Stderr, "Found deno in system PATH\n")
-	}
-
-	// Check and download yazi for file explorer integration (optional)
-	yaziBinary := "yazi"
-	if runtime.GOOS == "windows" {
-		yaziBinary = "yazi.exe"
-	}
-	yaziPath := filepath.Join(depsDir, yaziBinary)
-	if _, err := exec.LookPath(yaziBinary); err != nil {
-		if _, err := os.Stat(yaziPath); err != nil {
-			fmt.Fprintf(cfg.Stderr, "Downloading yazi for file explorer (optional)...\n")
-			// Yazi download URLs - using specific version for stability
-			var yaziURL string
-			switch runtime.GOOS {
-			case "linux":
-				yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-unknown-linux-gnu.zip"
-			case "darwin":
-				if runtime.GOARCH == "arm64" {
-					yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-aarch64-apple-darwin.zip"
-				} else {
-					yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-apple-darwin.zip"
-				}
-			case "windows":
-				yaziURL = "https://github.com/sxyazi/yazi/releases/latest/download/yazi-x86_64-pc-windows-msvc.zip"
-			}
+// Fastest download speed seen this session in bytes per second, shared by downloaders made
+// with WithConfig so later downloads size their auto fragments from it
+type bandwidthSample struct {
+	mu             sync.Mutex
+	bytesPerSecond float64
+}
 
-			if yaziURL != "" {
-				resp, err := http.Get(yaziURL)
-				if err == nil {
-					defer resp.Body.Close()
-					if resp.StatusCode == http.StatusOK {
-						zipPath := filepath.Join(depsDir, "yazi.zip")
-						zipFile, err := os.Create(zipPath)
-						if err == nil {
-							_, err = io.Copy(zipFile, resp.Body)
-							zipFile.Close()
-							if err == nil {
-								// Extract yazi binary
-								if err := extractYaziFromZip(zipPath, yaziPath); err == nil {
-									os.Remove(zipPath)
-									if runtime.GOOS != "windows" {
-										os.Chmod(yaziPath, 0o755)
-									}
-									fmt.Fprintf(cfg.Stderr, "Downloaded yazi to %s\n", yaziPath)
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+// Keeps speed if it is the fastest seen so far
+func (b *bandwidthSample) record(speed float64) {
+	if b == nil {
+		return
 	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bytesPerSecond = max(b.bytesPerSecond, speed)
+}
 
-	// Update last_check timestamp if versions were checked
-	if shouldCheckVersions {
-		if f, err := os.Create(lastCheckFile); err != nil {
-			fmt.Fprintf(cfg.Stderr, "Warning: Failed to update last_check timestamp: %v\n", err)
-		} else {
-			f.Close()
-		}
+// Returns the fastest speed seen, 0 before any download measured one
+func (b *bandwidthSample) get() float64 {
+	if b == nil {
+		return 0
 	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytesPerSecond
+}
 
-	// Install webtorrent-cli for torrent streaming support
-	webtorrentBinary := "webtorrent"
-	if runtime.GOOS == "windows" {
-		webtorrentBinary = "webtorrent.cmd"
-	}
+// Resolves Config.FragmentCount with the speed measured this session
+func (d *YTDLPDownloader) fragmentCount(def int) int {
+	return d.cfg.FragmentCount(def, d.bandwidth.get())
+}
 
-	// Check if webtorrent-cli is available
-	webtorrentInstalled := false
-	if _, err := exec.LookPath("webtorrent"); err == nil {
-		webtorrentInstalled = true
-		fmt.Fprintf(cfg.Stderr, "Found webtorrent-cli in system PATH\n")
-	} else {
-		// Check in dependencies folder
-		webtorrentPath := filepath.Join(depsDir, "bin", webtorrentBinary)
-		if _, err := os.Stat(webtorrentPath); err == nil {
-			webtorrentInstalled = true
-			fmt.Fprintf(cfg.Stderr, "Found webtorrent-cli in dependencies\n")
-		}
-	}
+// Kills a running download once it grows past Config.MaxFilesize
+type sizeGuard struct {
+	limit    int64
+	cmd      *exec.Cmd
+	exceeded atomic.Bool
+}
 
-	if !webtorrentInstalled {
-		fmt.Fprintf(cfg.Stderr, "Installing webtorrent-cli for torrent streaming...\n")
+// Returns a guard for cmd, or nil when no limit is configured
+func (d *YTDLPDownloader) newSizeGuard(cmd *exec.Cmd) *sizeGuard {
+	if d.cfg.MaxFilesize <= 0 {
+		return nil
+	}
+	return &sizeGuard{limit: d.cfg.MaxFilesize, cmd: cmd}
+}
 
-		// Use npm for installation (deno has issues with Node-API addons)
-		if _, err := exec.LookPath("npm"); err == nil {
-			fmt.Fprintf(cfg.Stderr, "Installing webtorrent-cli via npm...\n")
+func (g *sizeGuard) check(event ProgressEvent) {
+	if event.Downloaded > g.limit && g.exceeded.CompareAndSwap(false, true) && g.cmd.Process != nil {
+		_ = g.cmd.Process.Kill()
+	}
+}
 
-			// Install to dependencies folder
-			installCmd := exec.Command("npm", "install", "-g", "--prefix", depsDir, "webtorrent-cli")
-			installCmd.Stdout = cfg.Stderr
-			installCmd.Stderr = cfg.Stderr
-			err := installCmd.Run()
-			if err == nil {
-				fmt.Fprintf(cfg.Stderr, "Installed webtorrent-cli successfully\n")
-				webtorrentInstalled = true
-			} else {
-				fmt.Fprintf(cfg.Stderr, "npm install failed: %v\n", err)
-			}
-		} else {
-			fmt.Fprintf(cfg.Stderr, "npm not found, skipping webtorrent-cli installation\n")
-		}
+func (g *sizeGuard) tripped() bool {
+	return g != nil && g.exceeded.Load()
+}
 
-		if !webtorrentInstalled {
-			fmt.Fprintf(cfg.Stderr, "Warning: webtorrent-cli installation failed. Torrent streaming will not be available.\n")
-			fmt.Fprintf(cfg.Stderr, "You can install it manually: npm install -g webtorrent-cli\n")
+// Removes partial files left in dir by an aborted download
+func removePartialFiles(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if !entry.IsDir() && utils.IsPartialFile(entry.Name()) {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
 		}
 	}
+}
 
-	// Update PATH to include dependencies folder and bin directory
-	currentPath := os.Getenv("PATH")
-	binDir := filepath.Join(depsDir, "bin")
-	newPath := depsDir + string(os.PathListSeparator) + binDir + string(os.PathListSeparator) + currentPath
-	if err := os.Setenv("PATH", newPath); err != nil {
-		return nil, fmt.Errorf("failed to update PATH: %v", err)
+// Runs a download command at the priority set by Config.Nice
+func (d *YTDLPDownloader) runNiced(cmd *exec.Cmd) error {
+	if err := startNiced(cmd, d.cfg.Nice, d.cfg.Stderr); err != nil {
+		return err
 	}
+	return cmd.Wait()
+}
 
-	// Original dependency checks
-	if _, err := exec.LookPath(ytDlpBinary); err != nil {
-		return nil, errors.New("yt-dlp not installed")
+// Builds the yt-dlp output path, absolute templates bypass the temp directory
+func (d *YTDLPDownloader) outputPath(tempDir string) string {
+	template := utils.ExpandHome(d.cfg.ActiveOutputTemplate())
+	if filepath.IsAbs(template) {
+		return template
 	}
-	if _, err := exec.LookPath(aria2Binary); err != nil {
-		cfg.UseAria2c = false
-	}
-	return &YTDLPDownloader{cfg: cfg}, nil
+	return tempDir + "/" + template
 }
 
 // extractDenoFromZip extracts the deno binary from a zip archive
@@ -534,12 +377,7 @@ func readFile(path string) string {
 */
 
 // Fetches playlist info and video title in one command
-func (d *YTDLPDownloader) GetMetadata(args []string) (string, string, error) {
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
-	}
-
+func (d *YTDLPDownloader) GetMetadata(ctx context.Context, args []string) (string, string, error) {
 	// Check if this is a problematic site that needs special headers
 	url := ""
 	if len(args) > 0 {
@@ -585,33 +423,45 @@ func (d *YTDLPDownloader) GetMetadata(args []string) (string, string, error) {
 		}
 	}
 
-	if d.cfg.CookieBrowser != "" {
-		titleArgs = append(titleArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
+	titleArgs = append(titleArgs, accessArgs(d.cfg, url)...)
+	if d.cfg.WaitForVideo != "" {
+		titleArgs = append(titleArgs, "--wait-for-video", d.cfg.WaitForVideo)
+	}
+	titleArgs = append(titleArgs, urlLast(args)...)
+	titleOutput, err := d.runQuery(ctx, true, titleArgs...)
+	if errors.Is(err, ErrCommandTimeout) || ctx.Err() != nil {
+		return "", "", err
 	}
-	titleArgs = append(titleArgs, args...)
-	titleCmd := exec.Command(ytDlpCmd, titleArgs...)
-	titleOutput, err := titleCmd.CombinedOutput()
 	if err != nil {
 		// Include stderr output in error message for better debugging
 		if len(titleOutput) > 0 {
 			errMsg := strings.TrimSpace(string(titleOutput))
 
 			// Provide helpful hints for common errors
+			if IsDRMError(errMsg) {
+				return "", "", ErrDRMProtected
+			}
 			if strings.Contains(errMsg, "Unsupported URL") {
-				return "", "", fmt.Errorf("Invalid or unsupported URL. Please check the URL and try again")
+				return "", "", ErrUnsupportedURL
 			}
 			if strings.Contains(errMsg, "Video unavailable") {
-				return "", "", fmt.Errorf("Video is unavailable (may be private, deleted, or region-locked)")
+				return "", "", ErrVideoUnavailable
+			}
+			if err := CookieError(d.cfg, errMsg); err != nil {
+				return "", "", err
 			}
 			if strings.Contains(errMsg, "Sign in") || strings.Contains(errMsg, "Age-restricted") {
-				if d.cfg.CookieBrowser != "" {
-					return "", "", fmt.Errorf("Age-restricted video. Please make sure you are logged into YouTube in %s browser", d.cfg.CookieBrowser)
-				}
 				return "", "", fmt.Errorf("Age-restricted video. Browser cookies will be requested")
 			}
+			if strings.Contains(errMsg, "Impersonate target") && strings.Contains(errMsg, "not available") {
+				return "", "", fmt.Errorf("Impersonation target %q is not available. Install curl_cffi for yt-dlp (pip install curl_cffi) or use a bundled yt-dlp build", d.cfg.Impersonate)
+			}
 			if strings.Contains(errMsg, "HTTP Error 429") {
 				return "", "", fmt.Errorf("Rate limited by YouTube. Please try again later")
 			}
+			if IsUpcomingError(errMsg) {
+				return "", "", fmt.Errorf("%w. Use --wait-for-video to wait for it", ErrUpcomingVideo)
+			}
 			if strings.Contains(errMsg, "Requested format is not available") {
 				return "", "", fmt.Errorf("Video has no downloadable formats available. This may be due to regional restrictions, DRM protection, or YouTube's anti-bot measures. Try updating yt-dlp: pip install -U yt-dlp")
 			}
@@ -669,12 +519,12 @@ func (d *YTDLPDownloader) GetMetadata(args []string) (string, string, error) {
 		}
 	}
 
-	if d.cfg.CookieBrowser != "" {
-		playlistArgs = append(playlistArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
+	playlistArgs = append(playlistArgs, accessArgs(d.cfg, url)...)
+	playlistArgs = append(playlistArgs, urlLast(args)...)
+	playlistOutput, err := d.runQuery(ctx, false, playlistArgs...)
+	if errors.Is(err, ErrCommandTimeout) || ctx.Err() != nil {
+		return "", "", err
 	}
-	playlistArgs = append(playlistArgs, args...)
-	playlistCmd := exec.Command(ytDlpCmd, playlistArgs...)
-	playlistOutput, _ := playlistCmd.Output()
 
 	playlistData := strings.TrimSpace(string(playlistOutput))
 	var playlist, playlistTitle, playlistCount string
@@ -700,6 +550,124 @@ func (d *YTDLPDownloader) GetMetadata(args []string) (string, string, error) {
 	return playlistInfo, title, nil
 }
 
+// Checks that yt-dlp can impersonate the configured target
+func (d *YTDLPDownloader) CheckImpersonate(ctx context.Context) error {
+	if d.cfg.Impersonate == "" {
+		return nil
+	}
+	output, err := d.runQuery(ctx, true, "--list-impersonate-targets")
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list impersonate targets: %w", err)
+	}
+
+	// Target is client[-version][:os[-version]], match rows on the client column
+	target := strings.ToLower(strings.SplitN(d.cfg.Impersonate, ":", 2)[0])
+	found := false
+	for _, line := range splitLines(string(output)) {
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], target) {
+			continue
+		}
+		found = true
+		if !strings.Contains(line, "unavailable") {
+			return nil
+		}
+	}
+	if found {
+		return fmt.Errorf("impersonate target %q is unavailable, install curl_cffi for yt-dlp (pip install curl_cffi)", d.cfg.Impersonate)
+	}
+	return fmt.Errorf("unknown impersonate target %q, see yt-dlp --list-impersonate-targets", d.cfg.Impersonate)
+}
+
+// Lists the items of a playlist without downloading them
+func (d *YTDLPDownloader) GetPlaylistEntries(ctx context.Context, url string) ([]PlaylistEntry, error) {
+	cmdArgs := []string{"--flat-playlist", "--dump-single-json", "--no-warnings"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlist items: %w", err)
+	}
+
+	var playlist struct {
+		Entries []struct {
+			ID         string  `json:"id"`
+			URL        string  `json:"url"`
+			WebpageURL string  `json:"webpage_url"`
+			Title      string  `json:"title"`
+			Duration   float64 `json:"duration"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(output, &playlist); err != nil {
+		return nil, fmt.Errorf("failed to parse playlist items: %v", err)
+	}
+
+	entries := make([]PlaylistEntry, 0, len(playlist.Entries))
+	for i, e := range playlist.Entries {
+		entryURL := e.URL
+		if entryURL == "" {
+			entryURL = e.WebpageURL
+		}
+		if entryURL == "" {
+			entryURL = e.ID
+		}
+		if entryURL == "" {
+			continue
+		}
+		entries = append(entries, PlaylistEntry{
+			Index:    i + 1,
+			ID:       e.ID,
+			URL:      entryURL,
+			Title:    e.Title,
+			Duration: e.Duration,
+		})
+	}
+	return entries, nil
+}
+
+// Classifies a URL from the _type field of yt-dlp's info JSON
+func (d *YTDLPDownloader) GetMediaType(ctx context.Context, url string) (MediaType, error) {
+	// Entries aren't needed, only the top-level fields
+	cmdArgs := []string{"--flat-playlist", "--dump-single-json", "--playlist-items", "0", "--no-warnings"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if err != nil {
+		return MediaUnknown, fmt.Errorf("failed to fetch media type: %w", err)
+	}
+
+	var info struct {
+		Type       string `json:"_type"`
+		ID         string `json:"id"`
+		ChannelID  string `json:"channel_id"`
+		WebpageURL string `json:"webpage_url"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return MediaUnknown, fmt.Errorf("failed to parse media type: %v", err)
+	}
+	return classifyMedia(info.Type, info.ID, info.ChannelID, info.WebpageURL), nil
+}
+
+// Maps yt-dlp's _type and ids onto a MediaType
+func classifyMedia(infoType, id, channelID, webpageURL string) MediaType {
+	if infoType != "playlist" && infoType != "multi_video" {
+		return MediaSingle
+	}
+	trimmed := strings.TrimRight(webpageURL, "/")
+	for _, tab := range channelTabs {
+		if strings.HasSuffix(trimmed, tab) {
+			return MediaTab
+		}
+	}
+	if channelID != "" && id == channelID {
+		return MediaChannel
+	}
+	return MediaPlaylist
+}
+
 // StreamTorrent streams a torrent magnet link using webtorrent-cli with mpv or vlc
 func (d *YTDLPDownloader) StreamTorrent(magnetLink string) error {
 	// Check for media players (mpv has priority)
@@ -723,15 +691,7 @@ func (d *YTDLPDownloader) StreamTorrent(magnetLink string) error {
 		webtorrentPath = path
 	} else {
 		// Try dependencies/bin directory (npm install location)
-		// Use same persistent location as New() function
-		var depsDir string
-		homeDir, err := os.UserHomeDir()
-		if err == nil {
-			depsDir = filepath.Join(homeDir, ".yaria", "dependencies")
-		} else {
-			cwd, _ := os.Getwd()
-			depsDir = filepath.Join(cwd, "dependencies")
-		}
+		depsDir := utils.ResolveDepsDir(d.cfg.DepsDir)
 		binDir := filepath.Join(depsDir, "bin")
 
 		webtorrentBinary := "webtorrent"
@@ -765,13 +725,24 @@ func (d *YTDLPDownloader) StreamTorrent(magnetLink string) error {
 	return cmd.Run()
 }
 
-// Extracts video thumbnail to a temporary file
-func (d *YTDLPDownloader) GetThumbnail(args []string, tempDir string) (string, error) {
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
+// Fetches a video's info JSON without downloading it
+func (d *YTDLPDownloader) GetInfo(ctx context.Context, url string) (*VideoInfo, error) {
+	cmdArgs := []string{"--dump-single-json", "--skip-download", "--no-warnings", "--no-playlist"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch info: %w", err)
 	}
+	var info VideoInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse info: %v", err)
+	}
+	return &info, nil
+}
 
+// Extracts video thumbnail to a temporary file
+func (d *YTDLPDownloader) GetThumbnail(ctx context.Context, args []string, tempDir string) (string, error) {
 	// Create base thumbnail file path (yt-dlp will append video ID)
 	thumbnailBase := filepath.Join(tempDir, "yaria_thumb")
 
@@ -784,14 +755,10 @@ func (d *YTDLPDownloader) GetThumbnail(args []string, tempDir string) (string, e
 		"--output", thumbnailBase + ".%(ext)s",
 	}
 
-	if d.cfg.CookieBrowser != "" {
-		thumbnailArgs = append(thumbnailArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
-	}
-	thumbnailArgs = append(thumbnailArgs, args...)
+	thumbnailArgs = append(thumbnailArgs, accessArgs(d.cfg, urlArg(args))...)
+	thumbnailArgs = append(thumbnailArgs, urlLast(args)...)
 
-	cmd := exec.Command(ytDlpCmd, thumbnailArgs...)
-	err := cmd.Run()
-	if err != nil {
+	if _, err := d.runQuery(ctx, false, thumbnailArgs...); err != nil {
 		// If thumbnail extraction fails, return empty path (not critical error)
 		return "", nil
 	}
@@ -808,13 +775,13 @@ func (d *YTDLPDownloader) GetThumbnail(args []string, tempDir string) (string, e
 }
 
 // Predicts the output filename
-func (d *YTDLPDownloader) GetOutputFilename(args []string, tempDir string) (string, error) {
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
+func (d *YTDLPDownloader) GetOutputFilename(ctx context.Context, args []string, tempDir string) (string, error) {
+	if d.editsInfoJSON() && len(args) == 1 {
+		return d.outputFilenameFromInfo(ctx, args[0], tempDir)
 	}
-	cmd := exec.Command(ytDlpCmd, append([]string{"--print", "filename", "--output", tempDir + "/" + d.cfg.OutputTemplate}, args...)...)
-	output, err := cmd.Output()
+	queryArgs := append([]string{"--print", "filename", "--output", d.outputPath(tempDir)}, MergeArgs(d.cfg)...)
+	queryArgs = append(queryArgs, accessArgs(d.cfg, urlArg(args))...)
+	output, err := d.runQuery(ctx, false, append(queryArgs, urlLast(args)...)...)
 	if err != nil {
 		return "", err
 	}
@@ -825,131 +792,130 @@ func (d *YTDLPDownloader) GetOutputFilename(args []string, tempDir string) (stri
 	return "", errors.New("no filename found")
 }
 
-// Fetches available formats for a URL
-func (d *YTDLPDownloader) GetFormats(url string) ([]Format, error) {
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
+// Predicts the output filename from the full info JSON, which is kept for the download
+// to rewrite so the video is only queried once
+func (d *YTDLPDownloader) outputFilenameFromInfo(ctx context.Context, url, tempDir string) (string, error) {
+	queryArgs := append(d.infoJSONArgs(url), "--output", d.outputPath(tempDir))
+	queryArgs = append(queryArgs, MergeArgs(d.cfg)...)
+	output, err := d.runQuery(ctx, false, append(queryArgs, "--", url)...)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Filename string `json:"filename"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return "", fmt.Errorf("failed to parse info: %v", err)
+	}
+	if info.Filename == "" {
+		return "", errors.New("no filename found")
+	}
+	d.keepInfoJSON(url, output)
+	return info.Filename, nil
+}
+
+// Fetches available formats for a URL, reusing a listing younger than Config.FormatCacheTTL
+func (d *YTDLPDownloader) GetFormats(ctx context.Context, url string) ([]Format, error) {
+	formats, heights, err := d.cachedFormats(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	d.formatHeights = heights
+	return formats, nil
+}
+
+// Returns the cached listing of url, waiting for one already running, or lists the formats
+func (d *YTDLPDownloader) cachedFormats(ctx context.Context, url string) ([]Format, map[string]int, error) {
+	if d.cfg.FormatCacheTTL <= 0 {
+		return d.listFormats(ctx, url)
 	}
+	for {
+		if entry, ok := d.formats.get(url, d.cfg.FormatCacheTTL); ok {
+			return entry.formats, entry.heights, nil
+		}
+		running, claimed := d.formats.claim(url)
+		if claimed {
+			break
+		}
+		select {
+		case <-running:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	defer d.formats.release(url)
+	formats, heights, err := d.listFormats(ctx, url)
+	if err == nil {
+		d.formats.put(url, formats, heights)
+	}
+	return formats, heights, err
+}
+
+// Lists the formats of urls in the background, at most workers at a time, so later
+// GetFormats calls for them are answered from the cache
+func (d *YTDLPDownloader) PrefetchFormats(ctx context.Context, urls []string, workers int) {
+	if d.cfg.FormatCacheTTL <= 0 || workers <= 0 {
+		return
+	}
+	slots := make(chan struct{}, workers)
+	for _, url := range urls {
+		go func() {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			_, _, _ = d.cachedFormats(ctx, url)
+		}()
+	}
+}
+
+// Lists the formats of a URL from yt-dlp's info JSON, along with the height of every
+// format ID before deduplication
+func (d *YTDLPDownloader) listFormats(ctx context.Context, url string) ([]Format, map[string]int, error) {
 	cmdArgs := []string{
-		"--list-formats",
+		"-J",
 		"--no-warnings",
 		"--extractor-retries", "2",
+		// Playlists stand in with their first item instead of extracting every entry
+		"--no-playlist", "--playlist-items", "1",
 	}
-	if d.cfg.CookieBrowser != "" {
-		cmdArgs = append(cmdArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if errors.Is(err, ErrCommandTimeout) || ctx.Err() != nil {
+		return nil, nil, err
 	}
-	cmdArgs = append(cmdArgs, url)
-	cmd := exec.Command(ytDlpCmd, cmdArgs...)
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// Include stderr output in error message for better debugging
-		if len(output) > 0 {
-			errMsg := strings.TrimSpace(string(output))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			errMsg := strings.TrimSpace(string(exitErr.Stderr))
 			// Limit error message length
 			if len(errMsg) > 200 {
 				errMsg = errMsg[:200] + "..."
 			}
-			return nil, fmt.Errorf("%s", errMsg)
+			return nil, nil, fmt.Errorf("%s", errMsg)
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Debug: print raw output for non-YouTube sites
-	if strings.Contains(url, "youtube.com") == false {
-		fmt.Fprintf(d.cfg.Stderr, "DEBUG: Raw formats output for %s:\n%s\n", url, string(output))
+	var info formatsInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse formats: %v", err)
+	}
+	if len(info.Formats) == 0 && len(info.Entries) > 0 {
+		info = info.Entries[0]
 	}
-
 	var formats []Format
-	lines := splitLines(string(output))
-	for _, line := range lines {
-		// Skip header lines and empty lines
-		if strings.HasPrefix(line, "[") || strings.HasPrefix(line, " ") || len(strings.TrimSpace(line)) == 0 {
-			continue
-		}
-
-		// Look for format lines - more flexible matching
-		if strings.Contains(line, "video only") || strings.Contains(line, "audio only") ||
-			(strings.Contains(line, "mp4") || strings.Contains(line, "webm")) ||
-			(len(strings.Fields(line)) > 2 && strings.Fields(line)[0] != "ID" && !strings.Contains(line, "extension")) {
-			fields := strings.Fields(line)
-			if len(fields) < 2 {
-				continue
-			}
-			formatID := fields[0]
-			isAudio := strings.Contains(line, "audio only")
-			height := 0
-			ext := ""
-			protocol := ""
-			fileSize := ""
-			for _, field := range fields {
-				// Try to extract height from various formats
-				if strings.Contains(field, "x") && !isAudio {
-					parts := strings.Split(field, "x")
-					if len(parts) >= 2 {
-						// Remove any non-numeric characters from the second part
-						heightStr := strings.TrimSuffix(parts[1], "p")
-						heightStr = strings.TrimSuffix(heightStr, "i")
-						if res, err := strconv.Atoi(heightStr); err == nil {
-							height = res
-						}
-					}
-				} else if strings.HasSuffix(field, "p") && !isAudio {
-					// Handle formats like "720p"
-					heightStr := strings.TrimSuffix(field, "p")
-					if res, err := strconv.Atoi(heightStr); err == nil {
-						height = res
-					}
-				}
-				if strings.Contains(field, "mp4") || strings.Contains(field, "webm") || strings.Contains(field, "m4a") || strings.Contains(field, "mp3") {
-					ext = field
-				}
-				if strings.Contains(field, "http") || strings.Contains(field, "m3u8") {
-					protocol = field
-				}
-				// Parse file size
-				if strings.Contains(field, "iB") || strings.Contains(field, "B") {
-					if len(field) > 2 && (field[len(field)-2:] == "iB" || field[len(field)-1:] == "B") {
-						// Check if it's a valid size (starts with number)
-						if len(field) > 0 && (field[0] >= '0' && field[0] <= '9') {
-							fileSize = field
-						}
-					}
-				}
-			}
-			// Include formats with m3u8 as a fallback, prioritize http
-			// For non-YouTube sites, include formats even without explicit height
-			includeFormat := (isAudio && ext != "") || (!isAudio && height > 0 && ext != "")
-			if !includeFormat && !isAudio && !strings.Contains(url, "youtube.com") && ext != "" && protocol != "" {
-				// For non-YouTube sites, include video formats even without height
-				includeFormat = true
-				height = 720 // Default height for unknown formats
-			}
-
-			// Filter out invalid formats with missing critical info
-			if includeFormat && !isAudio {
-				// Must have extension and either height > 0 or protocol
-				if ext == "" || (height == 0 && protocol == "") {
-					includeFormat = false
-				}
-				// Filter out extremely low resolutions that are likely errors
-				if height > 0 && height < 144 {
-					includeFormat = false
-				}
-			}
-
-			if includeFormat {
-				formats = append(formats, Format{
-					ID:       formatID,
-					Height:   height,
-					Ext:      ext,
-					IsAudio:  isAudio,
-					Protocol: protocol,
-					FileSize: fileSize,
-				})
-			}
+	for _, jf := range info.Formats {
+		if f, ok := jf.toFormat(strings.Contains(url, "youtube.com")); ok {
+			formats = append(formats, f)
 		}
 	}
+	// Remember heights so a vanished format can be remapped during Download
+	heights := make(map[string]int)
+	for _, f := range formats {
+		heights[f.ID] = f.Height
+	}
+
 	// Deduplicate and filter formats - keep only the best format for each resolution
 	uniqueFormats := make(map[int]Format) // map[height]bestFormat
 
@@ -997,16 +963,195 @@ func (d *YTDLPDownloader) GetFormats(url string) ([]Format, error) {
 		}
 	}
 
-	return sortedFormats, nil
+	// Audio streams go last so callers can tell audio-only sources apart from unlisted ones
+	for _, f := range formats {
+		if f.IsAudio {
+			sortedFormats = append(sortedFormats, f)
+		}
+	}
+
+	return sortedFormats, heights, nil
+}
+
+// Format entry of the formats array in yt-dlp's info JSON
+type jsonFormat struct {
+	FormatID       string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Height         int     `json:"height"`
+	FPS            float64 `json:"fps"`
+	VCodec         string  `json:"vcodec"`
+	ACodec         string  `json:"acodec"`
+	Protocol       string  `json:"protocol"`
+	Filesize       float64 `json:"filesize"`
+	FilesizeApprox float64 `json:"filesize_approx"`
+	TBR            float64 `json:"tbr"`
+}
+
+// The parts of yt-dlp's info JSON that listFormats reads
+type formatsInfo struct {
+	Formats []jsonFormat  `json:"formats"`
+	Entries []formatsInfo `json:"entries"`
+}
+
+// Converts a yt-dlp format, reporting false for ones that can't be offered, like storyboards.
+// Video without a known height is kept on other sites than YouTube as 720p.
+func (jf jsonFormat) toFormat(youtube bool) (Format, bool) {
+	vcodec, acodec := knownCodec(jf.VCodec), knownCodec(jf.ACodec)
+	isAudio := jf.VCodec == "none"
+	if jf.Ext == "" || (isAudio && acodec == "") {
+		return Format{}, false
+	}
+	f := Format{
+		ID:       jf.FormatID,
+		Ext:      jf.Ext,
+		IsAudio:  isAudio,
+		Protocol: jf.Protocol,
+		VCodec:   vcodec,
+		ACodec:   acodec,
+		TBR:      jf.TBR,
+	}
+	switch {
+	case jf.Filesize > 0:
+		f.SizeBytes = int64(jf.Filesize)
+		f.FileSize = utils.HumanBytes(f.SizeBytes)
+	case jf.FilesizeApprox > 0:
+		f.SizeBytes = int64(jf.FilesizeApprox)
+		f.SizeApprox = true
+		f.FileSize = "~" + utils.HumanBytes(f.SizeBytes)
+	}
+	short := func(codec string) string {
+		name, _, _ := strings.Cut(codec, ".")
+		return name
+	}
+	if isAudio {
+		f.Codec = short(acodec)
+		return f, true
+	}
+
+	f.Height = jf.Height
+	if f.Height == 0 {
+		if youtube || f.Protocol == "" {
+			return Format{}, false
+		}
+		f.Height = 720
+	}
+	// Extremely low resolutions are likely errors
+	if f.Height < 144 {
+		return Format{}, false
+	}
+	f.FPS = int(math.Round(jf.FPS))
+	f.Codec = short(vcodec)
+	if acodec != "" {
+		f.Codec += "+" + short(acodec)
+	}
+	return f, true
+}
+
+// Returns codec, or empty when yt-dlp reports it as absent or unknown
+func knownCodec(codec string) string {
+	if codec == "none" {
+		return ""
+	}
+	return codec
+}
+
+// Picks the available format closest in height to current, the format that wasn't available
+func (d *YTDLPDownloader) remapFormat(ctx context.Context, url, current string) (string, bool) {
+	target := d.formatHeights[current]
+	formats, err := d.GetFormats(ctx, url)
+	if err != nil {
+		return "", false
+	}
+	best := -1
+	for i, f := range formats {
+		if f.IsAudio || f.ID == current {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		// Unknown original height keeps the highest format, otherwise prefer the closest (higher on ties)
+		diff, bestDiff := abs(f.Height-target), abs(formats[best].Height-target)
+		if target > 0 && (diff < bestDiff || (diff == bestDiff && f.Height > formats[best].Height)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return formats[best].ID, true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
 }
 
-// Executes the download process with retries and fallback
-func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error) {
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
+// Executes the download process with retries and fallback. Cancelling ctx kills yt-dlp
+// and returns ctx's error without further attempts.
+func (d *YTDLPDownloader) Download(ctx context.Context, args []string, tempDir string) (success bool, err error) {
+	defer func() {
+		if d.onProgress == nil {
+			return
+		}
+		if err != nil {
+			d.onProgress(ProgressEvent{Status: ProgressError, Line: err.Error()})
+		} else if success {
+			d.onProgress(ProgressEvent{Status: ProgressFinished, Percent: 100})
+		}
+	}()
+	ytDlpCmd := YTDLPCommand(d.cfg)
+	// Library callers may set CookieBrowser directly, so check it before spawning yt-dlp
+	if err := d.cfg.ValidateCookieFile(); err != nil {
+		return false, err
 	}
+	if err := d.cfg.ValidateCookieBrowser(); err != nil {
+		return false, err
+	}
+	// Chapters parsed by yaria and the chosen thumbnail reach yt-dlp through an edited info JSON in place of the URL
+	// The URL is passed last, after "--", so one starting with "-" is never read as an option
+	downloadArgs, urlArgs := args, []string(nil)
+	if len(args) > 0 {
+		downloadArgs, urlArgs = args[1:], []string{"--", args[0]}
+	}
+	if d.editsInfoJSON() && len(args) > 0 {
+		infoPath, err := d.editedInfoJSON(ctx, args[0], tempDir)
+		if err != nil {
+			fmt.Fprintf(d.cfg.Stderr, "WARNING: Could not prepare chapters or thumbnail: %v\n", err)
+		} else if infoPath != "" {
+			defer os.Remove(infoPath)
+			downloadArgs = append([]string{"--load-info-json", infoPath}, args[1:]...)
+			urlArgs = nil
+		}
+	}
+
+	// Format requested for this call, replaced here rather than in the shared config when it has to be remapped
+	resolution := d.cfg.Resolution
+
+	subtitleArgs := SubtitleArgs(d.cfg)
+	if d.cfg.WriteSubs && !d.cfg.IsAudioOnly && len(args) > 0 && d.subtitlesEmbedded(ctx, args, tempDir) {
+		fmt.Fprintf(d.cfg.Stderr, "Subtitles are already embedded, not fetching them again\n")
+		subCfg := *d.cfg
+		subCfg.WriteSubs = false
+		subtitleArgs = SubtitleArgs(&subCfg)
+	}
+
+	// Args after the format that every attempt passes the same way, ending with the URL
+	sharedArgs := func() []string {
+		shared := slices.Concat(downloadArgs, DefaultSubtitleArgs(d.cfg, args), subtitleArgs, PlaylistItemsArgs(d.cfg))
+		shared = append(shared, CommonDownloadArgs(d.cfg, urlArg(args), d.bandwidth.get())...)
+		return append(shared, urlArgs...)
+	}
+
+	remapped := false
+	var lastFailure *DownloadError
 	for attempt := 1; attempt <= d.cfg.MaxRetries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
 		// Check if this is a problematic site that needs special handling
 		problematicSites := []string{
 			"pornhub.com", "xvideos.com", "xhamster.com", "youporn.com", "redtube.com",
@@ -1035,7 +1180,7 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 			cmdArgs = []string{
 				"--no-overwrites",
 				"--geo-bypass",
-				"--concurrent-fragments", "8",
+				"--concurrent-fragments", strconv.Itoa(d.fragmentCount(8)),
 				"--buffer-size", "32K",
 				"--http-chunk-size", "4M",
 				"--no-warnings",
@@ -1053,7 +1198,7 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 			cmdArgs = []string{
 				"--no-overwrites",
 				"--geo-bypass",
-				"--concurrent-fragments", "16",
+				"--concurrent-fragments", strconv.Itoa(d.fragmentCount(16)),
 				"--buffer-size", "64K",
 				"--http-chunk-size", "8M",
 				"--no-warnings",
@@ -1071,10 +1216,10 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 			"--no-mtime",
 			"--no-playlist",
 			"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-			"--output", tempDir+"/"+d.cfg.OutputTemplate,
+			"--output", d.outputPath(tempDir),
 		)
-		if d.cfg.CookieBrowser != "" {
-			cmdArgs = append(cmdArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
+		if d.onProgress != nil {
+			cmdArgs = append(cmdArgs, "--progress-template", progressTemplate)
 		}
 
 		// Add site-specific headers and settings
@@ -1141,29 +1286,25 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 		}
 		if d.cfg.IsAudioOnly {
 			cmdArgs = append(cmdArgs, "--extract-audio", "--audio-format", d.cfg.AudioFormat)
-		} else if d.cfg.Resolution != "" {
-			cmdArgs = append(cmdArgs, "--format", d.cfg.Resolution+"+bestaudio/best")
+		} else if resolution != "" && d.cfg.RawFormat {
+			cmdArgs = append(cmdArgs, "--format", resolution)
+		} else if resolution != "" {
+			cmdArgs = append(cmdArgs, "--format", resolution+"+bestaudio/best")
 		} else {
-			// Use more compatible format selection for problematic sites
-			if isProblematic {
+			// Use more compatible format selection for problematic sites, unless the user redefined the default
+			if isProblematic && d.cfg.DefaultFormat == config.BestFormat {
 				cmdArgs = append(cmdArgs, "--format", "best[height<=1080]/best")
 			} else {
-				cmdArgs = append(cmdArgs, "--format", "bestvideo+bestaudio/best")
-			}
-		}
-		cmdArgs = append(cmdArgs, args...)
-
-		if d.cfg.UseAria2c {
-			aria2Cmd := "aria2c"
-			if runtime.GOOS == "windows" {
-				aria2Cmd = "aria2c.exe"
+				cmdArgs = append(cmdArgs, "--format", d.cfg.DefaultFormat)
 			}
-			cmdArgs = append(cmdArgs, "--downloader", aria2Cmd, "--downloader-args", "aria2c:"+d.cfg.Aria2cArgs)
 		}
-
-		cmd := exec.Command(ytDlpCmd, cmdArgs...)
-		cmd.Stdout = d.cfg.Stdout
-		cmd.Stderr = d.cfg.Stderr
+		cmdArgs = append(cmdArgs, sharedArgs()...)
+		cmd := exec.CommandContext(ctx, ytDlpCmd, cmdArgs...)
+		cmd.WaitDelay = killWaitDelay
+		guard := d.newSizeGuard(cmd)
+		cmd.Stdout = d.stdout(guard)
+		var stderrBuf bytes.Buffer
+		cmd.Stderr = io.MultiWriter(d.cfg.Stderr, &stderrBuf)
 
 		// Set environment variables for better performance
 		cmd.Env = append(os.Environ(),
@@ -1172,16 +1313,39 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 			"PYTHONUNBUFFERED=1",
 		)
 
-		if err := cmd.Run(); err == nil {
+		if err := d.runNiced(cmd); err == nil {
 			return true, nil
 		} else {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			// A runaway download would only grow past the limit again, so don't retry
+			if guard.tripped() {
+				removePartialFiles(tempDir)
+				return false, fmt.Errorf("download aborted after exceeding max filesize of %d bytes", d.cfg.MaxFilesize)
+			}
+			if lastFailure, err = d.classifyAttempt(stderrBuf.String()); err != nil {
+				return false, err
+			}
+			// The selected format can vanish between listing and download, remap it once without using up a retry
+			if !remapped && resolution != "" && !d.cfg.RawFormat && len(args) > 0 &&
+				strings.Contains(stderrBuf.String(), "Requested format is not available") {
+				remapped = true
+				if newID, ok := d.remapFormat(ctx, args[0], resolution); ok {
+					fmt.Fprintf(d.cfg.Stderr, "Format %s is no longer available, retrying with closest format %s\n", resolution, newID)
+					resolution = newID
+					attempt--
+					continue
+				}
+			}
 			d.cfg.Stderr.Write([]byte("WARNING: Download failed with selected format, trying fallback format...\n"))
-			// Try fallback format on last attempt
-			if attempt == d.cfg.MaxRetries {
+			// Try fallback format on last attempt, unless the user pinned an exact format
+			if attempt == d.cfg.MaxRetries && !d.cfg.RawFormat {
+				// Only the tuning flags and the format differ from the other attempts
 				fallbackArgs := []string{
 					"--no-overwrites",
 					"--geo-bypass",
-					"--concurrent-fragments", "8",
+					"--concurrent-fragments", strconv.Itoa(d.fragmentCount(8)),
 					"--buffer-size", "32K",
 					"--http-chunk-size", "4M",
 					"--no-warnings",
@@ -1194,27 +1358,23 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 					"--no-mtime",
 					"--no-playlist",
 					"--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
-					"--output", tempDir + "/" + d.cfg.OutputTemplate,
+					"--output", d.outputPath(tempDir),
 				}
-				if d.cfg.CookieBrowser != "" {
-					fallbackArgs = append(fallbackArgs, "--cookies-from-browser", d.cfg.CookieBrowser)
+				if d.onProgress != nil {
+					fallbackArgs = append(fallbackArgs, "--progress-template", progressTemplate)
 				}
 				if d.cfg.IsAudioOnly {
 					fallbackArgs = append(fallbackArgs, "--extract-audio", "--audio-format", d.cfg.AudioFormat)
 				} else {
 					fallbackArgs = append(fallbackArgs, "--format", "bestvideo[height<=1080]+bestaudio/best")
 				}
-				fallbackArgs = append(fallbackArgs, args...)
-				if d.cfg.UseAria2c {
-					aria2Cmd := "aria2c"
-					if runtime.GOOS == "windows" {
-						aria2Cmd = "aria2c.exe"
-					}
-					fallbackArgs = append(fallbackArgs, "--downloader", aria2Cmd, "--downloader-args", "aria2c:"+d.cfg.Aria2cArgs)
-				}
-				cmd := exec.Command(ytDlpCmd, fallbackArgs...)
-				cmd.Stdout = d.cfg.Stdout
-				cmd.Stderr = d.cfg.Stderr
+				fallbackArgs = append(fallbackArgs, sharedArgs()...)
+				cmd := exec.CommandContext(ctx, ytDlpCmd, fallbackArgs...)
+				cmd.WaitDelay = killWaitDelay
+				guard := d.newSizeGuard(cmd)
+				cmd.Stdout = d.stdout(guard)
+				var fallbackStderr bytes.Buffer
+				cmd.Stderr = io.MultiWriter(d.cfg.Stderr, &fallbackStderr)
 
 				// Set environment variables for better performance
 				cmd.Env = append(os.Environ(),
@@ -1222,16 +1382,71 @@ func (d *YTDLPDownloader) Download(args []string, tempDir string) (bool, error)
 					"PYTHONDONTWRITEBYTECODE=1",
 					"PYTHONUNBUFFERED=1",
 				)
-				if err := cmd.Run(); err == nil {
+				if err := d.runNiced(cmd); err == nil {
 					return true, nil
 				}
+				if ctx.Err() != nil {
+					return false, ctx.Err()
+				}
+				if guard.tripped() {
+					removePartialFiles(tempDir)
+					return false, fmt.Errorf("download aborted after exceeding max filesize of %d bytes", d.cfg.MaxFilesize)
+				}
+				// The fallback ends the download, so its output is what gets reported
+				if lastFailure, err = d.classifyAttempt(fallbackStderr.String()); err != nil {
+					return false, err
+				}
 			}
 			if attempt < d.cfg.MaxRetries {
-				d.cfg.WaitBeforeRetry(attempt)
+				if err := d.cfg.WaitBeforeRetry(ctx, attempt, retryAfterHint(stderrBuf.String(), attempt, d.cfg.RetryDelay)); err != nil {
+					return false, err
+				}
 			}
 		}
 	}
-	return false, errors.New("all download attempts failed, including fallback")
+	if lastFailure != nil {
+		lastFailure.Err = fmt.Errorf("%w, including fallback", ErrDownloadFailed)
+		return false, lastFailure
+	}
+	return false, fmt.Errorf("%w, including fallback", ErrDownloadFailed)
+}
+
+// Classifies the stderr of a failed attempt. The error is set when no other attempt can
+// succeed: DRM, stale cookies, or content that is gone or unsupported.
+func (d *YTDLPDownloader) classifyAttempt(stderr string) (*DownloadError, error) {
+	// Retrying or switching formats can't get around DRM
+	if IsDRMError(stderr) {
+		return nil, ErrDRMProtected
+	}
+	// Retrying with the same stale cookies fails the same way
+	if err := CookieError(d.cfg, stderr); err != nil {
+		return nil, err
+	}
+	// Gone or unsupported content fails the same way on every attempt
+	failure := classifyFailure(stderr)
+	if failure.Kind == FailureFatal {
+		return failure, failure
+	}
+	return failure, nil
+}
+
+// Matches waits reported alongside rate limiting, e.g. "Retry-After: 30" or "Sleeping 12.5 seconds"
+var retryAfterRegex = regexp.MustCompile(`(?i)(?:retry-after:?|retry after|sleeping)\s+(\d+(?:\.\d+)?)`)
+
+// Longest backoff used for a 429 without an explicit wait
+const maxRateLimitBackoff = 5 * time.Minute
+
+// Derives how long to wait after a failed attempt from yt-dlp's stderr.
+// An explicit wait wins, a bare 429 backs off exponentially from base.
+func retryAfterHint(stderr string, attempt int, base time.Duration) time.Duration {
+	if matches := retryAfterRegex.FindAllStringSubmatch(stderr, -1); len(matches) > 0 {
+		seconds, _ := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if strings.Contains(stderr, "HTTP Error 429") || strings.Contains(stderr, "Too Many Requests") {
+		return min(base<<attempt, maxRateLimitBackoff)
+	}
+	return 0
 }
 
 // Splits a string into lines and trims whitespace
@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"fmt"
+	"slices"
+
+	"yaria/config"
+)
+
+// Audio formats written as bare streams, with no container to hold cover art or tags
+var bareAudioFormats = []string{"aac", "wav"}
+
+// Reports whether cfg's audio output can hold embedded thumbnails and metadata
+func embedSupported(cfg *config.Config) bool {
+	return !cfg.IsAudioOnly || !slices.Contains(bareAudioFormats, cfg.AudioFormat)
+}
+
+// Returns args embedding the thumbnail and metadata enabled in cfg, or nil when neither
+// is enabled or the output format can't hold them
+func EmbedArgs(cfg *config.Config) []string {
+	if (!cfg.EmbedThumbnail && !cfg.EmbedMetadata) || !embedSupported(cfg) {
+		return nil
+	}
+	var args []string
+	if cfg.EmbedMetadata {
+		args = append(args, "--embed-metadata")
+	}
+	if cfg.EmbedThumbnail {
+		// Sites mostly serve webp, which mp3 and m4a players don't show as cover art
+		if cfg.IsAudioOnly {
+			args = append(args, "--convert-thumbnails", "jpg")
+		}
+		args = append(args, "--embed-thumbnail")
+	}
+	return args
+}
+
+// Explains why embedding enabled in cfg will be skipped, or "" when it won't be
+func EmbedWarning(cfg *config.Config) string {
+	if (!cfg.EmbedThumbnail && !cfg.EmbedMetadata) || embedSupported(cfg) {
+		return ""
+	}
+	return fmt.Sprintf("%s files can't hold an embedded thumbnail or metadata, skipping embedding", cfg.AudioFormat)
+}
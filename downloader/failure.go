@@ -0,0 +1,77 @@
+package downloader
+
+import (
+	"errors"
+	"strings"
+)
+
+// Whether retrying a failed yt-dlp run can help
+type FailureKind string
+
+const (
+	FailureRetryable FailureKind = "retryable" // Network trouble, timeouts and anything unrecognized
+	FailureFatal     FailureKind = "fatal"     // The content can't be downloaded, retrying gives the same result
+)
+
+// Returned when the video is private, removed or otherwise gone
+var ErrVideoUnavailable = errors.New("video is unavailable (may be private, deleted, or region-locked)")
+
+// Returned by Download when yt-dlp fails, with the classification and the last lines of its stderr
+type DownloadError struct {
+	Kind   FailureKind
+	Err    error    // Cause, e.g. ErrVideoUnavailable or ErrDownloadFailed
+	Stderr []string // Last lines yt-dlp wrote to stderr
+}
+
+func (e *DownloadError) Error() string {
+	if len(e.Stderr) == 0 {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Stderr[len(e.Stderr)-1]
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// yt-dlp messages that retrying can't fix, with the error they stand for
+var fatalFailures = []struct {
+	marker string
+	err    error
+}{
+	{"Unsupported URL", ErrUnsupportedURL},
+	{"Video unavailable", ErrVideoUnavailable},
+	{"Private video", ErrVideoUnavailable},
+	{"This video has been removed", ErrVideoUnavailable},
+	{"has been terminated", ErrVideoUnavailable},
+	{"Unable to download webpage: HTTP Error 404", ErrVideoUnavailable},
+	{"Unable to download webpage: HTTP Error 410", ErrVideoUnavailable},
+}
+
+// How many trailing stderr lines a DownloadError keeps
+const stderrTailLines = 5
+
+// Classifies a failed yt-dlp run by its stderr. Unrecognized failures count as retryable
+// and are reported as ErrDownloadFailed.
+func classifyFailure(stderr string) *DownloadError {
+	failure := &DownloadError{Kind: FailureRetryable, Err: ErrDownloadFailed, Stderr: tailLines(stderr, stderrTailLines)}
+	for _, fatal := range fatalFailures {
+		if strings.Contains(stderr, fatal.marker) {
+			failure.Kind = FailureFatal
+			failure.Err = fatal.err
+			break
+		}
+	}
+	return failure
+}
+
+// Returns the last n non-empty lines of s
+func tailLines(s string, n int) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines[max(len(lines)-n, 0):]
+}
@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"yaria/config"
+)
+
+const (
+	// Longest a single dependency or release request may take, body included
+	fetchTimeout = 10 * time.Minute
+	// How long a server may take to start answering before the request counts as stalled
+	fetchHeaderTimeout = 30 * time.Second
+	// Tries per dependency download before giving up
+	fetchAttempts = 3
+	// Wait before the first retry, growing with each attempt
+	fetchRetryDelay = 2 * time.Second
+)
+
+// Non-200 answer to a dependency download
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return "HTTP status " + e.status
+}
+
+// Returns the client shared by dependency downloads and release lookups, going through
+// the configured proxy and giving up on stalled connections
+func dependencyClient(cfg *config.Config) *http.Client {
+	client := httpClient(cfg)
+	client.Transport.(*http.Transport).ResponseHeaderTimeout = fetchHeaderTimeout
+	client.Timeout = fetchTimeout
+	return client
+}
+
+// Runs fetch until it succeeds, fails for good or ctx is done, waiting a little longer
+// between each try
+func withFetchRetries(ctx context.Context, fetch func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fetch()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil || attempt == fetchAttempts || !transientFetchError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * fetchRetryDelay):
+		}
+	}
+}
+
+// Reports whether a failed fetch may succeed when tried again: network errors, server
+// errors and rate limits do, other HTTP statuses and local file errors don't
+func transientFetchError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == http.StatusTooManyRequests
+	}
+	var pathErr *os.PathError
+	return !errors.As(err, &pathErr)
+}
+
+// Streams url into w in a single try
+func fetchOnce(ctx context.Context, client *http.Client, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &httpStatusError{code: resp.StatusCode, status: resp.Status}
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Downloads url into memory, retrying transient failures
+func fetchBytes(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := withFetchRetries(ctx, func() error {
+		buf.Reset()
+		return fetchOnce(ctx, client, url, &buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Downloads url to dest, retrying transient failures. The data goes to a .part file that
+// replaces dest only once complete, so a failed or cancelled download leaves dest as it was.
+func fetchFile(ctx context.Context, client *http.Client, url, dest string) error {
+	partPath := dest + ".part"
+	err := withFetchRetries(ctx, func() error {
+		out, err := os.Create(partPath)
+		if err != nil {
+			return err
+		}
+		err = fetchOnce(ctx, client, url, out)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+	if err == nil {
+		err = os.Rename(partPath, dest)
+	}
+	if err != nil {
+		os.Remove(partPath)
+	}
+	return err
+}
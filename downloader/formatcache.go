@@ -0,0 +1,73 @@
+package downloader
+
+import (
+	"sync"
+	"time"
+)
+
+// Formats listed for one URL, with the heights Download remaps vanished formats by
+type formatCacheEntry struct {
+	formats []Format
+	heights map[string]int
+	fetched time.Time
+}
+
+// Parsed GetFormats results keyed by URL, shared by downloaders made with WithConfig
+type formatCache struct {
+	mu      sync.Mutex
+	entries map[string]formatCacheEntry
+	running map[string]chan struct{} // Listings in progress, closed when they finish
+}
+
+func newFormatCache() *formatCache {
+	return &formatCache{entries: make(map[string]formatCacheEntry), running: make(map[string]chan struct{})}
+}
+
+// Returns the entry for url if it is younger than ttl
+func (c *formatCache) get(url string, ttl time.Duration) (formatCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[url]
+	if !ok || time.Since(entry.fetched) >= ttl {
+		delete(c.entries, url)
+		return formatCacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *formatCache) put(url string, formats []Format, heights map[string]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[url] = formatCacheEntry{formats: formats, heights: heights, fetched: time.Now()}
+}
+
+// Claims listing the formats of url. When another listing is already running, returns
+// false and a channel closed once it finishes.
+func (c *formatCache) claim(url string) (<-chan struct{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if running, ok := c.running[url]; ok {
+		return running, false
+	}
+	c.running[url] = make(chan struct{})
+	return nil, true
+}
+
+// Ends a listing claimed with claim, waking up those waiting for it
+func (c *formatCache) release(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.running[url])
+	delete(c.running, url)
+}
+
+// Drops the cached formats of url, or of every URL when url is empty
+func (d *YTDLPDownloader) InvalidateFormats(url string) {
+	d.formats.mu.Lock()
+	defer d.formats.mu.Unlock()
+	if url == "" {
+		clear(d.formats.entries)
+		return
+	}
+	delete(d.formats.entries, url)
+}
@@ -0,0 +1,277 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yaria/utils"
+)
+
+// Extensions of files the native downloader fetches without extraction
+var directMediaExts = []string{
+	".mp4", ".mkv", ".webm", ".mov", ".avi", ".m4v", ".flv",
+	".mp3", ".m4a", ".aac", ".flac", ".wav", ".ogg", ".opus",
+}
+
+// Files smaller than this are fetched with a single request
+const minSplitSize = 4 << 20
+
+// Reports whether rawURL points straight at a media file rather than a page to extract
+func IsDirectMediaURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	for _, e := range directMediaExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Downloads a direct file URL into destDir with parallel ranged GETs, returning the file path.
+// Cancelling ctx stops every request and removes the partial file.
+func (d *YTDLPDownloader) DownloadHTTP(ctx context.Context, rawURL, destDir string) (string, error) {
+	client := httpClient(d.cfg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	head, err := client.Do(req)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to reach %s: %v", rawURL, err)
+	}
+	head.Body.Close()
+	if head.StatusCode >= 400 {
+		return "", fmt.Errorf("server returned %s", head.Status)
+	}
+
+	name := httpFilename(head, rawURL)
+	dest := filepath.Join(destDir, name)
+	if utils.FileExists(dest) {
+		return "", fmt.Errorf("file already exists: %s", dest)
+	}
+	partPath := dest + ".part"
+	if d.cfg.NoPart {
+		partPath = dest
+	}
+	file, err := os.Create(partPath)
+	if err != nil {
+		return "", err
+	}
+
+	size := head.ContentLength
+	var done atomic.Int64
+	stop := make(chan struct{})
+	reported := make(chan struct{})
+	go func() {
+		d.reportHTTPProgress(&done, size, dest, stop)
+		close(reported)
+	}()
+
+	limiter := newRateLimiter(d.cfg.RateLimit)
+	parts := d.fragmentCount(8)
+	if head.Header.Get("Accept-Ranges") == "bytes" && size >= minSplitSize && parts > 1 {
+		err = fetchRanges(ctx, client, rawURL, file, size, parts, &done, limiter)
+	} else {
+		err = fetchWhole(ctx, client, rawURL, file, &done, limiter)
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	close(stop)
+	<-reported
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(partPath)
+		return "", err
+	}
+	if partPath != dest {
+		if err := os.Rename(partPath, dest); err != nil {
+			return "", err
+		}
+	}
+	if d.onProgress != nil {
+		d.onProgress(ProgressEvent{Status: ProgressFinished, Percent: 100, Downloaded: done.Load(), Total: size, Filename: dest})
+	}
+	return dest, nil
+}
+
+// Streams the whole body into file
+func fetchWhole(ctx context.Context, client *http.Client, rawURL string, file *os.File, done *atomic.Int64, limiter *rateLimiter) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	_, err = io.Copy(file, &countingReader{r: resp.Body, n: done, limiter: limiter})
+	return err
+}
+
+// Splits the file into ranges and fetches them concurrently, writing each at its offset.
+// The first failing range cancels the others and its error is returned.
+func fetchRanges(ctx context.Context, client *http.Client, rawURL string, file *os.File, size int64, parts int, done *atomic.Int64, limiter *rateLimiter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunk := (size + int64(parts) - 1) / int64(parts)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	for start := int64(0); start < size; start += chunk {
+		end := min(start+chunk, size) - 1
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+			if err != nil {
+				fail(err)
+				return
+			}
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+			resp, err := client.Do(req)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusPartialContent {
+				fail(fmt.Errorf("range request returned %s", resp.Status))
+				return
+			}
+			w := io.NewOffsetWriter(file, start)
+			n, err := io.Copy(w, &countingReader{r: resp.Body, n: done, limiter: limiter})
+			if err == nil && n != end-start+1 {
+				err = fmt.Errorf("range %d-%d ended early after %d bytes", start, end, n)
+			}
+			if err != nil {
+				fail(err)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Sends progress events every half second until stop is closed
+func (d *YTDLPDownloader) reportHTTPProgress(done *atomic.Int64, size int64, filename string, stop <-chan struct{}) {
+	if d.onProgress == nil {
+		<-stop
+		return
+	}
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			n := done.Load()
+			rate := float64(n) / time.Since(start).Seconds()
+			event := ProgressEvent{Status: ProgressDownloading, Downloaded: n, Speed: rate, Filename: filename}
+			if size > 0 {
+				event.Total = size
+				event.Percent = float64(n) / float64(size) * 100
+				if rate > 0 {
+					event.ETA = time.Duration(float64(size-n) / rate * float64(time.Second))
+				}
+			}
+			d.onProgress(event)
+		}
+	}
+}
+
+// Picks a filename from Content-Disposition, falling back to the URL path
+func httpFilename(resp *http.Response, rawURL string) string {
+	name := "download"
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = filepath.Base(params["filename"])
+	} else if u, err := url.Parse(rawURL); err == nil {
+		if base, err := url.PathUnescape(path.Base(u.Path)); err == nil && base != "/" && base != "." {
+			name = base
+		}
+	}
+	ext := filepath.Ext(name)
+	return utils.SanitizeFileBase(strings.TrimSuffix(name, ext), ext)
+}
+
+// Formats a byte count with binary units like yt-dlp
+func FormatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%s", n, units[i])
+}
+
+// Counts bytes read so progress can be reported across goroutines
+type countingReader struct {
+	r       io.Reader
+	n       *atomic.Int64
+	limiter *rateLimiter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.limiter.wait(c.n.Add(int64(n)))
+	return n, err
+}
+
+// Holds the readers of one download back so their combined average stays under Config.RateLimit
+type rateLimiter struct {
+	bytesPerSecond float64
+	start          time.Time
+}
+
+// Returns a limiter for an aria2-style rate like "2M", or nil when there is no limit
+func newRateLimiter(rate string) *rateLimiter {
+	bytesPerSecond, err := utils.ParseSize(rate)
+	if rate == "" || err != nil || bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSecond: float64(bytesPerSecond), start: time.Now()}
+}
+
+// Sleeps until total bytes are due at the limited rate, nil limiters never wait
+func (l *rateLimiter) wait(total int64) {
+	if l == nil {
+		return
+	}
+	due := time.Duration(float64(total) / l.bytesPerSecond * float64(time.Second))
+	if ahead := due - time.Since(l.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+}
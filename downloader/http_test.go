@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Serves a file large enough to be split into ranges, answering each range with ranged
+func rangeServer(t *testing.T, ranged http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(2*minSplitSize))
+			return
+		}
+		ranged(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Answers a range request with its headers, then holds the body until the client goes away
+func stall(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusPartialContent)
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
+
+// Fails when DownloadHTTP left anything behind in dir
+func assertEmpty(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("partial output left behind: %s", entry.Name())
+	}
+}
+
+func TestDownloadHTTPRangeFailureCancelsOthers(t *testing.T) {
+	srv := rangeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		stall(w, r)
+	})
+	cfg := testConfig(t)
+	cfg.ConcurrentFragments = "4"
+	d := &YTDLPDownloader{cfg: cfg}
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := d.DownloadHTTP(ctx, srv.URL+"/video.mp4", dir)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("DownloadHTTP error = %v, want the failed range's status", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("stalled ranges were not cancelled after one failed")
+	}
+	assertEmpty(t, dir)
+}
+
+func TestDownloadHTTPCancel(t *testing.T) {
+	started := make(chan struct{}, 4)
+	srv := rangeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		stall(w, r)
+	})
+	cfg := testConfig(t)
+	cfg.ConcurrentFragments = "4"
+	d := &YTDLPDownloader{cfg: cfg}
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err := d.DownloadHTTP(ctx, srv.URL+"/video.mp4", dir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DownloadHTTP error = %v, want %v", err, context.Canceled)
+	}
+	assertEmpty(t, dir)
+}
@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Reports whether Download rewrites the info JSON, for chapters or a picked thumbnail
+func (d *YTDLPDownloader) editsInfoJSON() bool {
+	return d.cfg.ChaptersFrom != "" || d.cfg.ThumbnailID != ""
+}
+
+// Returns the args of the info JSON query for url that editedInfoJSON rewrites, without the URL
+func (d *YTDLPDownloader) infoJSONArgs(url string) []string {
+	cmdArgs := []string{"--dump-single-json", "--no-warnings", "--no-playlist"}
+	if d.cfg.ChaptersFrom == ChaptersFromComments {
+		// Pinned and top comments are where timestamp lists usually live
+		cmdArgs = append(cmdArgs, "--write-comments", "--extractor-args", "youtube:max_comments=50,50,0,0;comment_sort=top")
+	}
+	return append(cmdArgs, accessArgs(d.cfg, url)...)
+}
+
+// Keeps the info JSON of url fetched while predicting its filename for the download's rewrite
+func (d *YTDLPDownloader) keepInfoJSON(url string, data []byte) {
+	d.infoMu.Lock()
+	defer d.infoMu.Unlock()
+	if d.fetchedInfo == nil {
+		d.fetchedInfo = make(map[string][]byte)
+	}
+	d.fetchedInfo[url] = data
+}
+
+// Returns and forgets the info JSON kept for url, so retries fetch fresh stream URLs
+func (d *YTDLPDownloader) takeInfoJSON(url string) ([]byte, bool) {
+	d.infoMu.Lock()
+	defer d.infoMu.Unlock()
+	data, ok := d.fetchedInfo[url]
+	delete(d.fetchedInfo, url)
+	return data, ok
+}
+
+// Writes the info JSON of url with yaria's additions: chapters from cfg.ChaptersFrom and
+// the thumbnail picked by cfg.ThumbnailID. Returns an empty path when nothing changed.
+// Reuses the info JSON fetched by GetOutputFilename instead of querying yt-dlp again.
+func (d *YTDLPDownloader) editedInfoJSON(ctx context.Context, url, dir string) (string, error) {
+	output, ok := d.takeInfoJSON(url)
+	if !ok {
+		var err error
+		output, err = d.runQuery(ctx, false, append(d.infoJSONArgs(url), "--", url)...)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch info: %w", err)
+		}
+	}
+
+	var info map[string]any
+	if err := json.Unmarshal(output, &info); err != nil {
+		return "", fmt.Errorf("failed to parse info: %v", err)
+	}
+	changed := false
+	if d.cfg.ChaptersFrom != "" {
+		changed = d.addChapters(info)
+		// Comments are only needed for parsing, don't carry them into the download
+		delete(info, "comments")
+	}
+	if d.cfg.ThumbnailID != "" {
+		if err := d.selectThumbnail(info); err != nil {
+			fmt.Fprintf(d.cfg.Stderr, "WARNING: %v, keeping yt-dlp's choice\n", err)
+		} else {
+			changed = true
+		}
+	}
+	if !changed {
+		return "", nil
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "yaria_edited.info.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Returns yt-dlp's complete info JSON for url without downloading anything
+func (d *YTDLPDownloader) DumpJSON(ctx context.Context, url string) ([]byte, error) {
+	cmdArgs := []string{"-J", "--skip-download", "--no-warnings", "--no-playlist"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch info: %w", err)
+	}
+	if !json.Valid(output) {
+		return nil, fmt.Errorf("yt-dlp returned invalid JSON")
+	}
+	return output, nil
+}
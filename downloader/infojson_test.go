@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"yaria/config"
+)
+
+// Returns the user's config with yt-dlp's warnings discarded
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, _ := config.New()
+	cfg.Stderr = io.Discard
+	return cfg
+}
+
+func TestEditedInfoJSON(t *testing.T) {
+	const url = "https://example.com/watch?v=1"
+	info := map[string]any{
+		"id":          "1",
+		"duration":    120.0,
+		"description": "0:00 Intro\n1:00 Main",
+		"comments":    []any{map[string]any{"text": "great"}},
+		"thumbnails": []any{
+			map[string]any{"id": "0", "url": "https://i.example.com/small.jpg", "width": 120.0, "height": 90.0},
+			map[string]any{"id": "1", "url": "https://i.example.com/large.jpg", "width": 1280.0, "height": 720.0},
+		},
+		"thumbnail": "https://i.example.com/small.jpg",
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		chaptersFrom string
+		thumbnailID  string
+		check        func(t *testing.T, edited map[string]any)
+	}{
+		{
+			name:         "chapters from description",
+			chaptersFrom: ChaptersFromDescription,
+			check: func(t *testing.T, edited map[string]any) {
+				want := []any{
+					map[string]any{"start_time": 0.0, "end_time": 60.0, "title": "Intro"},
+					map[string]any{"start_time": 60.0, "end_time": 120.0, "title": "Main"},
+				}
+				if !reflect.DeepEqual(edited["chapters"], want) {
+					t.Errorf("chapters = %v, want %v", edited["chapters"], want)
+				}
+				if _, ok := edited["comments"]; ok {
+					t.Error("comments were carried into the edited info JSON")
+				}
+			},
+		},
+		{
+			name:        "largest thumbnail",
+			thumbnailID: LargestThumbnail,
+			check: func(t *testing.T, edited map[string]any) {
+				if got := edited["thumbnail"]; got != "https://i.example.com/large.jpg" {
+					t.Errorf("thumbnail = %v, want the large one", got)
+				}
+				if thumbs, _ := edited["thumbnails"].([]any); len(thumbs) != 1 {
+					t.Errorf("thumbnails = %v, want only the picked one", edited["thumbnails"])
+				}
+				if edited["description"] != info["description"] {
+					t.Error("unrelated fields changed")
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.ChaptersFrom = tt.chaptersFrom
+			cfg.ThumbnailID = tt.thumbnailID
+			d := &YTDLPDownloader{cfg: cfg}
+			// Kept as GetOutputFilename does, so no yt-dlp query runs
+			d.keepInfoJSON(url, data)
+
+			path, err := d.editedInfoJSON(context.Background(), url, t.TempDir())
+			if err != nil {
+				t.Fatalf("editedInfoJSON: %v", err)
+			}
+			if path == "" {
+				t.Fatal("editedInfoJSON changed nothing")
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var edited map[string]any
+			if err := json.Unmarshal(raw, &edited); err != nil {
+				t.Fatalf("edited info JSON: %v", err)
+			}
+			tt.check(t, edited)
+			if _, ok := d.takeInfoJSON(url); ok {
+				t.Error("kept info JSON was not used up")
+			}
+		})
+	}
+}
+
+func TestEditedInfoJSONUnchanged(t *testing.T) {
+	const url = "https://example.com/watch?v=2"
+	cfg := testConfig(t)
+	cfg.ChaptersFrom = ChaptersFromDescription
+	d := &YTDLPDownloader{cfg: cfg}
+	d.keepInfoJSON(url, []byte(`{"id":"2","duration":60,"description":"no stamps here"}`))
+
+	dir := t.TempDir()
+	path, err := d.editedInfoJSON(context.Background(), url, dir)
+	if err != nil || path != "" {
+		t.Fatalf("editedInfoJSON = %q, %v, want no file", path, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("wrote %d files for an unchanged info JSON", len(entries))
+	}
+}
@@ -0,0 +1,29 @@
+package downloader
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"yaria/config"
+)
+
+// Containers yt-dlp's --merge-output-format accepts
+var mergeFormats = []string{"avi", "flv", "mkv", "mov", "mp4", "webm"}
+
+// Checks that format is a single container yt-dlp can merge into
+func ValidateMergeFormat(format string) error {
+	if !slices.Contains(mergeFormats, format) {
+		return fmt.Errorf("unsupported merge format %q, expected one of %s", format, strings.Join(mergeFormats, ", "))
+	}
+	return nil
+}
+
+// Returns args fixing the container of merged video downloads to Config.MergeOutputFormat,
+// so the output filename yt-dlp predicts is the one it writes
+func MergeArgs(cfg *config.Config) []string {
+	if cfg.MergeOutputFormat == "" || cfg.IsAudioOnly {
+		return nil
+	}
+	return []string{"--merge-output-format", cfg.MergeOutputFormat}
+}
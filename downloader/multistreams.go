@@ -0,0 +1,16 @@
+package downloader
+
+import "yaria/config"
+
+// Returns args letting a format expression merge several audio or video streams,
+// e.g. "137+140+251" for a main and a commentary track
+func MultistreamArgs(cfg *config.Config) []string {
+	var args []string
+	if cfg.AudioMultistreams {
+		args = append(args, "--audio-multistreams")
+	}
+	if cfg.VideoMultistreams {
+		args = append(args, "--video-multistreams")
+	}
+	return args
+}
@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// Streams the download into a named pipe at path so another process, e.g. a transcoder,
+// can read it as it arrives. A pipe created here is removed when streaming ends.
+func (d *YTDLPDownloader) StreamToPipe(args []string, path string) error {
+	created, err := makeFIFO(path)
+	if err != nil {
+		return err
+	}
+	if created {
+		defer os.Remove(path)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Opening the write end blocks until a reader opens the pipe
+	fmt.Fprintf(d.cfg.Stderr, "Waiting for a reader on %s...\n", path)
+	opened := make(chan error, 1)
+	var pipe *os.File
+	go func() {
+		var err error
+		pipe, err = os.OpenFile(path, os.O_WRONLY, 0)
+		opened <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("interrupted while waiting for a reader on %s", path)
+	case err := <-opened:
+		if err != nil {
+			return fmt.Errorf("failed to open pipe %s: %v", path, err)
+		}
+	}
+	defer pipe.Close()
+
+	ytDlpCmd := YTDLPCommand(d.cfg)
+	// yt-dlp reports progress on stderr when writing the media to stdout
+	cmdArgs := []string{"--output", "-", "--no-part"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, urlArg(args))...)
+	cmdArgs = append(cmdArgs, RateLimitArgs(d.cfg)...)
+	cmdArgs = append(cmdArgs, urlLast(args)...)
+	cmd := exec.CommandContext(ctx, ytDlpCmd, cmdArgs...)
+	cmd.Stdout = pipe
+	cmd.Stderr = d.cfg.Stderr
+
+	fmt.Fprintf(d.cfg.Stderr, "Streaming to %s\n", path)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("streaming to %s interrupted", path)
+		}
+		return fmt.Errorf("streaming to %s failed (the reader may have closed the pipe): %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package downloader
+
+import "errors"
+
+// Named pipes at filesystem paths are only available on Unix-like systems
+func makeFIFO(path string) (bool, error) {
+	return false, errors.New("--output-pipe is not supported on this platform")
+}
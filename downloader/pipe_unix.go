@@ -0,0 +1,23 @@
+//go:build unix
+
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Creates a FIFO at path, reusing an existing one. Reports whether it was created here.
+func makeFIFO(path string) (bool, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return false, fmt.Errorf("%s exists and is not a named pipe", path)
+		}
+		return false, nil
+	}
+	if err := syscall.Mkfifo(path, 0o644); err != nil {
+		return false, fmt.Errorf("failed to create named pipe %s: %v", path, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yaria/config"
+)
+
+// Inclusive range of 1-based playlist indexes
+type itemRange struct {
+	start, end int
+}
+
+// Parses a --playlist-items value like "1-5,8,10-12"
+func parsePlaylistItems(spec string) ([]itemRange, error) {
+	var ranges []itemRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid playlist item %q, expected an index like 3 or a range like 1-5", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(last); err != nil || end < start {
+				return nil, fmt.Errorf("invalid playlist range %q, expected START-END with START <= END", part)
+			}
+		}
+		ranges = append(ranges, itemRange{start, end})
+	}
+	return ranges, nil
+}
+
+// Checks that spec is a comma-separated list of indexes and START-END ranges
+func ValidatePlaylistItems(spec string) error {
+	_, err := parsePlaylistItems(spec)
+	return err
+}
+
+// Reports whether the 1-based index is picked by spec, an empty spec picks every item
+func PlaylistItemSelected(spec string, index int) bool {
+	if spec == "" {
+		return true
+	}
+	ranges, _ := parsePlaylistItems(spec)
+	for _, r := range ranges {
+		if index >= r.start && index <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts the items of a total-item playlist picked by spec
+func PlaylistItemsCount(spec string, total int) int {
+	count := 0
+	for i := 1; i <= total; i++ {
+		if PlaylistItemSelected(spec, i) {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns yt-dlp's --playlist-items flag for Config.PlaylistItems
+func PlaylistItemsArgs(cfg *config.Config) []string {
+	if cfg.PlaylistItems == "" {
+		return nil
+	}
+	return []string{"--playlist-items", cfg.PlaylistItems}
+}
@@ -0,0 +1,57 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"yaria/config"
+)
+
+// Returned when the preflight check can't reach the target site
+var ErrNoConnection = errors.New("no internet connection")
+
+// Time allowed for each preflight step
+const preflightTimeout = 5 * time.Second
+
+// Checks that the target URL's host resolves and answers over HTTP, so a missing
+// connection or captive portal is reported up front instead of after yt-dlp retries
+func Preflight(cfg *config.Config, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		// Not a URL yt-dlp needs the network for in a way we can check, e.g. "ytsearch:..."
+		return nil
+	}
+
+	scheme := u.Scheme
+	if scheme != "http" {
+		scheme = "https"
+	}
+	req, err := http.NewRequest(http.MethodHead, scheme+"://"+u.Host+"/", nil)
+	if err != nil {
+		return nil
+	}
+
+	// Behind a proxy the site's host may not resolve locally, the proxy resolves it instead
+	if proxyURL, _ := proxyFunc(cfg)(req); proxyURL == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+		defer cancel()
+		if _, err := net.DefaultResolver.LookupHost(ctx, u.Hostname()); err != nil {
+			return fmt.Errorf("%w: could not resolve %s", ErrNoConnection, u.Hostname())
+		}
+	}
+
+	// Any response counts, captive portals fail the TLS handshake or time out instead
+	client := httpClient(cfg)
+	client.Timeout = preflightTimeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: could not reach %s", ErrNoConnection, u.Host)
+	}
+	resp.Body.Close()
+	return nil
+}
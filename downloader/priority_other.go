@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package downloader
+
+import (
+	"io"
+	"os/exec"
+)
+
+// Process priorities aren't supported on this platform, cmd runs at the default
+func startNiced(cmd *exec.Cmd, nice int, stderr io.Writer) error {
+	return cmd.Start()
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Starts cmd and sets its niceness. Processes it spawns later, like aria2c and ffmpeg, inherit it.
+func startNiced(cmd *exec.Cmd, nice int, stderr io.Writer) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if nice != 0 {
+		// Raising priority needs privileges, a failure only costs the adjustment
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, cmd.Process.Pid, nice); err != nil {
+			fmt.Fprintf(stderr, "Warning: Failed to set process priority to %d: %v\n", nice, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package downloader
+
+import (
+	"io"
+	"os/exec"
+	"syscall"
+)
+
+// Windows priority classes, see CreateProcess
+const (
+	idlePriorityClass        = 0x00000040
+	belowNormalPriorityClass = 0x00004000
+	aboveNormalPriorityClass = 0x00008000
+	highPriorityClass        = 0x00000080
+)
+
+// Starts cmd in the priority class closest to the niceness, which child processes inherit
+func startNiced(cmd *exec.Cmd, nice int, stderr io.Writer) error {
+	var class uint32
+	switch {
+	case nice >= 15:
+		class = idlePriorityClass
+	case nice > 0:
+		class = belowNormalPriorityClass
+	case nice <= -15:
+		class = highPriorityClass
+	case nice < 0:
+		class = aboveNormalPriorityClass
+	}
+	if class != 0 {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.CreationFlags |= class
+	}
+	return cmd.Start()
+}
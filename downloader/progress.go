@@ -0,0 +1,230 @@
+package downloader
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yaria/utils"
+)
+
+// Values of ProgressEvent.Status
+const (
+	ProgressDownloading    = "downloading"
+	ProgressPostprocessing = "postprocessing"
+	ProgressFinished       = "finished"
+	ProgressError          = "error"
+)
+
+// Progress update passed to the callback set with SetProgressCallback. It backs the TUI
+// progress bar, the server's event stream and any library consumer. Zero values mean unknown.
+type ProgressEvent struct {
+	Status     string        `json:"status"`               // One of the Progress* constants
+	Percent    float64       `json:"percent"`              // 0-100 for the current file
+	Downloaded int64         `json:"downloaded,omitempty"` // Bytes of the current file
+	Total      int64         `json:"total,omitempty"`      // Expected size of the current file in bytes
+	Speed      float64       `json:"speed,omitempty"`      // Bytes per second
+	ETA        time.Duration `json:"eta,omitempty"`        // Time left for the current file, nanoseconds in JSON
+	Filename   string        `json:"filename,omitempty"`   // File being written or postprocessed
+	ItemIndex  int           `json:"item_index,omitempty"` // 1-based playlist position
+	ItemCount  int           `json:"item_count,omitempty"` // Playlist items being downloaded
+	Line       string        `json:"line,omitempty"`       // Raw output line, or the error message
+}
+
+// yt-dlp progress line used while a callback is set. It reads like the default line but ends
+// with exact byte counts, so events don't have to work sizes out from rounded strings.
+const progressTemplate = "download:[download] %(progress._percent_str)s of %(progress._total_bytes_str)s at %(progress._speed_str)s ETA %(progress._eta_str)s " +
+	"(%(progress.downloaded_bytes)s/%(progress.total_bytes,progress.total_bytes_estimate)s bytes)"
+
+var (
+	// [download]  45.2% of 123.45MiB at 1.23MiB/s ETA 01:23
+	ytdlpProgressRegex = regexp.MustCompile(`\[download\]\s+(\d+\.?\d*)%`)
+	// [#abc123 45.2MiB/123.45MiB(36%) CN:16 DL:1.2MiB ETA:1m23s], several per line for fragments
+	aria2cProgressRegex = regexp.MustCompile(`\[#\w+ [^\]]*\((\d+)%\)`)
+	speedRegex          = regexp.MustCompile(`(?:DL:|at\s+)(\d+\.?\d*\s*[KMGT]?i?B)(?:/s)?`)
+	etaRegex            = regexp.MustCompile(`ETA[:\s]+(\S+)`)
+	// "of ~ 123.45MiB" total reported next to the percentage
+	totalSizeRegex = regexp.MustCompile(`of\s+~?\s*(\d+\.?\d*\s*[KMGT]?i?B)`)
+	// aria2c "45.2MiB/123.45MiB" downloaded/total pair
+	aria2cSizeRegex = regexp.MustCompile(`(\d+\.?\d*[KMGT]?i?B)/(\d+\.?\d*[KMGT]?i?B)`)
+	// Live streams without a known size: [download]   12.34MiB at 1.20MiB/s (00:00:10)
+	liveSizeRegex = regexp.MustCompile(`\[download\]\s+(\d+\.?\d*[KMGT]?i?B)\s+at`)
+	// [download] Destination: /path/to/file.mp4
+	destinationRegex = regexp.MustCompile(`^\[\w+\] Destination: (.+)$`)
+	// [download] Downloading item 3 of 10 (older yt-dlp says "video")
+	playlistItemRegex = regexp.MustCompile(`^\[download\] Downloading (?:item|video) (\d+) of (\d+)`)
+	// [Merger] Merging formats into "file.mkv", [EmbedSubtitle] ..., [ExtractAudio] ...
+	postprocessorRegex = regexp.MustCompile(`^\[(Merger|ExtractAudio|Fixup\w*|Embed\w*|Metadata|ffmpeg|VideoConvertor|VideoRemuxer|SponsorBlock|ModifyChapters|SplitChapters|ThumbnailsConvertor|MoveFiles)\]`)
+	mergeTargetRegex   = regexp.MustCompile(`Merging formats into "(.+)"`)
+	// "(4739563/10485760 bytes)" ending progressTemplate lines, NA when the total is unknown
+	exactBytesRegex = regexp.MustCompile(`\((\d+)/(\d+|NA) bytes\)$`)
+)
+
+// Parses a single line of yt-dlp or aria2c output into a download or postprocessing event
+func parseProgress(line string) (ProgressEvent, bool) {
+	if postprocessorRegex.MatchString(line) {
+		return ProgressEvent{Status: ProgressPostprocessing, Percent: 100, Line: line}, true
+	}
+	matches := ytdlpProgressRegex.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		matches = aria2cProgressRegex.FindStringSubmatch(line)
+	}
+	if len(matches) < 2 {
+		// Unknown-size streams only report bytes so far
+		if live := liveSizeRegex.FindStringSubmatch(line); len(live) >= 2 {
+			event := ProgressEvent{Status: ProgressDownloading, Line: line}
+			event.Downloaded, _ = utils.ParseSize(live[1])
+			event.Speed = parseSpeed(line)
+			return event, true
+		}
+		if exactBytesRegex.MatchString(line) {
+			event := ProgressEvent{Status: ProgressDownloading, Line: line}
+			event.Speed = parseSpeed(line)
+			setExactBytes(&event, line)
+			return event, true
+		}
+		return ProgressEvent{}, false
+	}
+	percent, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return ProgressEvent{}, false
+	}
+	event := ProgressEvent{Status: ProgressDownloading, Percent: percent, Line: line}
+	if sizeMatches := aria2cSizeRegex.FindStringSubmatch(line); len(sizeMatches) >= 3 {
+		event.Downloaded, _ = utils.ParseSize(sizeMatches[1])
+		event.Total, _ = utils.ParseSize(sizeMatches[2])
+	} else if totalMatches := totalSizeRegex.FindStringSubmatch(line); len(totalMatches) >= 2 {
+		if total, err := utils.ParseSize(totalMatches[1]); err == nil {
+			event.Total = total
+			event.Downloaded = int64(float64(total) * percent / 100)
+		}
+	}
+	setExactBytes(&event, line)
+	event.Speed = parseSpeed(line)
+	if etaMatches := etaRegex.FindStringSubmatch(line); len(etaMatches) >= 2 {
+		event.ETA = parseETA(etaMatches[1])
+	}
+	return event, true
+}
+
+// Replaces sizes estimated from rounded strings with the byte counts of a progressTemplate line
+func setExactBytes(event *ProgressEvent, line string) {
+	matches := exactBytesRegex.FindStringSubmatch(line)
+	if len(matches) < 3 {
+		return
+	}
+	event.Downloaded, _ = strconv.ParseInt(matches[1], 10, 64)
+	if total, err := strconv.ParseInt(matches[2], 10, 64); err == nil {
+		event.Total = total
+		// yt-dlp prints "N/A%" when it can't work the percentage out itself
+		if event.Percent == 0 && total > 0 {
+			event.Percent = float64(event.Downloaded) / float64(total) * 100
+		}
+	}
+}
+
+// Returns the bytes per second reported on a progress line, 0 when missing
+func parseSpeed(line string) float64 {
+	matches := speedRegex.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		return 0
+	}
+	speed, err := utils.ParseSize(matches[1])
+	if err != nil {
+		return 0
+	}
+	return float64(speed)
+}
+
+// Converts yt-dlp's [h:]mm:ss or aria2c's 1h2m3s ETA, 0 when unknown
+func parseETA(eta string) time.Duration {
+	eta = strings.TrimRight(eta, "]")
+	if strings.Contains(eta, ":") {
+		return time.Duration(parseTimestamp(eta)) * time.Second
+	}
+	d, err := time.ParseDuration(eta)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// Parses yt-dlp or aria2c output read from r, sending each progress event on the
+// returned channel, which is closed once r is exhausted
+func StreamProgress(r io.Reader) <-chan ProgressEvent {
+	events := make(chan ProgressEvent, 64)
+	go func() {
+		defer close(events)
+		w := newProgressWriter(io.Discard, func(event ProgressEvent) {
+			events <- event
+		})
+		_, _ = io.Copy(w, r)
+	}()
+	return events
+}
+
+// Passes output through while reporting parsed progress lines
+type progressWriter struct {
+	out      io.Writer
+	callback func(ProgressEvent)
+	mu       sync.Mutex
+	buf      []byte
+	// Context from earlier lines attached to each event
+	filename  string
+	itemIndex int
+	itemCount int
+}
+
+func newProgressWriter(out io.Writer, callback func(ProgressEvent)) *progressWriter {
+	return &progressWriter{out: out, callback: callback}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	// Split on CR or LF so carriage-return updates are reported too
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+		if line == "" {
+			continue
+		}
+		if event, ok := w.parseLine(line); ok {
+			w.callback(event)
+		}
+	}
+	return w.out.Write(p)
+}
+
+// Tracks the current file and playlist item, returning an event for progress and postprocessing lines
+func (w *progressWriter) parseLine(line string) (ProgressEvent, bool) {
+	if matches := playlistItemRegex.FindStringSubmatch(line); len(matches) >= 3 {
+		w.itemIndex, _ = strconv.Atoi(matches[1])
+		w.itemCount, _ = strconv.Atoi(matches[2])
+		return ProgressEvent{}, false
+	}
+	if matches := destinationRegex.FindStringSubmatch(line); len(matches) >= 2 {
+		w.filename = matches[1]
+	} else if matches := mergeTargetRegex.FindStringSubmatch(line); len(matches) >= 2 {
+		w.filename = matches[1]
+	}
+
+	event, ok := parseProgress(line)
+	if !ok {
+		return ProgressEvent{}, false
+	}
+	event.Filename = w.filename
+	event.ItemIndex = w.itemIndex
+	event.ItemCount = w.itemCount
+	return event, true
+}
@@ -0,0 +1,204 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+// Byte multiples, float so sizes like 1.52 GiB can be written as 1.52 * gib
+var (
+	kib = 1024.0
+	mib = 1024 * kib
+	gib = 1024 * mib
+)
+
+// Returns the bytes done of total at percent, as estimated for lines without exact counts
+func share(total int64, percent float64) int64 {
+	return int64(float64(total) * percent / 100)
+}
+
+// Returns a speed as parsed, in whole bytes per second
+func rate(bytesPerSecond float64) float64 {
+	return float64(int64(bytesPerSecond))
+}
+
+// Lines captured from yt-dlp and aria2c runs
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		ok   bool
+		want ProgressEvent
+	}{
+		{
+			name: "native percent",
+			line: "[download]  45.2% of  123.45MiB at    1.23MiB/s ETA 01:23",
+			ok:   true,
+			want: ProgressEvent{Percent: 45.2, Downloaded: share(int64(123.45*mib), 45.2), Total: int64(123.45 * mib), Speed: rate(1.23 * mib), ETA: 83 * time.Second},
+		},
+		{
+			name: "whole percent",
+			line: "[download]   7% of   10.00MiB at  512.00KiB/s ETA 00:18",
+			ok:   true,
+			want: ProgressEvent{Percent: 7, Downloaded: share(int64(10*mib), 7), Total: int64(10 * mib), Speed: rate(512 * kib), ETA: 18 * time.Second},
+		},
+		{
+			name: "GiB total with hour ETA",
+			line: "[download]   3.1% of    1.52GiB at   10.24MiB/s ETA 1:02:03",
+			ok:   true,
+			want: ProgressEvent{Percent: 3.1, Downloaded: share(int64(1.52*gib), 3.1), Total: int64(1.52 * gib), Speed: rate(10.24 * mib), ETA: time.Hour + 2*time.Minute + 3*time.Second},
+		},
+		{
+			name: "bytes per second",
+			line: "[download]   0.1% of   50.00MiB at  850.00B/s ETA 16:25",
+			ok:   true,
+			want: ProgressEvent{Percent: 0.1, Downloaded: share(int64(50*mib), 0.1), Total: int64(50 * mib), Speed: 850, ETA: 985 * time.Second},
+		},
+		{
+			name: "finished",
+			line: "[download] 100% of   10.00MiB in 00:00:05 at 1.95MiB/s",
+			ok:   true,
+			want: ProgressEvent{Percent: 100, Downloaded: int64(10 * mib), Total: int64(10 * mib), Speed: rate(1.95 * mib)},
+		},
+		{
+			name: "unknown speed and ETA",
+			line: "[download]   0.0% of   10.00MiB at  Unknown B/s ETA Unknown",
+			ok:   true,
+			want: ProgressEvent{Total: int64(10 * mib)},
+		},
+		{
+			name: "HLS fragment with estimated size",
+			line: "[download]  12.5% of ~ 300.00MiB at    2.50MiB/s ETA 01:45 (frag 15/120)",
+			ok:   true,
+			want: ProgressEvent{Percent: 12.5, Downloaded: share(int64(300*mib), 12.5), Total: int64(300 * mib), Speed: rate(2.5 * mib), ETA: 105 * time.Second},
+		},
+		{
+			name: "first HLS fragment",
+			line: "[download]   0.0% of ~  50.07MiB at  Unknown B/s ETA Unknown (frag 0/120)",
+			ok:   true,
+			want: ProgressEvent{Total: int64(50.07 * mib)},
+		},
+		{
+			name: "DASH fragment",
+			line: "[download]  67.3% of ~   1.07GiB at    5.12MiB/s ETA 00:59 (frag 201/299)",
+			ok:   true,
+			want: ProgressEvent{Percent: 67.3, Downloaded: share(int64(1.07*gib), 67.3), Total: int64(1.07 * gib), Speed: rate(5.12 * mib), ETA: 59 * time.Second},
+		},
+		{
+			name: "progress template with exact bytes",
+			line: "[download]  45.2% of  10.00MiB at    1.23MiB/s ETA 00:04 (4739563/10485760 bytes)",
+			ok:   true,
+			want: ProgressEvent{Percent: 45.2, Downloaded: 4739563, Total: 10485760, Speed: rate(1.23 * mib), ETA: 4 * time.Second},
+		},
+		{
+			name: "progress template with unknown total",
+			line: "[download]  N/A% of  N/A at    1.23MiB/s ETA N/A (4739563/NA bytes)",
+			ok:   true,
+			want: ProgressEvent{Downloaded: 4739563, Speed: rate(1.23 * mib)},
+		},
+		{
+			name: "progress template without percent",
+			line: "[download] N/A% of 10.00MiB at 1.00MiB/s ETA 00:05 (5242880/10485760 bytes)",
+			ok:   true,
+			want: ProgressEvent{Percent: 50, Downloaded: 5242880, Total: 10485760, Speed: rate(mib)},
+		},
+		{
+			name: "live stream",
+			line: "[download]   12.34MiB at    1.20MiB/s (00:00:10)",
+			ok:   true,
+			want: ProgressEvent{Downloaded: int64(12.34 * mib), Speed: rate(1.2 * mib)},
+		},
+		{
+			name: "aria2c",
+			line: "[#2089b0 45.2MiB/123.4MiB(36%) CN:16 DL:1.2MiB ETA:1m5s]",
+			ok:   true,
+			want: ProgressEvent{Percent: 36, Downloaded: int64(45.2 * mib), Total: int64(123.4 * mib), Speed: rate(1.2 * mib), ETA: 65 * time.Second},
+		},
+		{
+			name: "aria2c KiB with hour ETA",
+			line: "[#f3d86f 400KiB/1.1GiB(0%) CN:1 DL:512KiB ETA:1h2m3s]",
+			ok:   true,
+			want: ProgressEvent{Downloaded: int64(400 * kib), Total: int64(1.1 * gib), Speed: rate(512 * kib), ETA: time.Hour + 2*time.Minute + 3*time.Second},
+		},
+		{
+			name: "aria2c fragment summary",
+			line: "[DL:6.2MiB][#2089b0 1.0MiB/1.0MiB(99%)][#f3d86f 400KiB/1.1MiB(35%)]",
+			ok:   true,
+			want: ProgressEvent{Percent: 99, Downloaded: int64(mib), Total: int64(mib), Speed: rate(6.2 * mib)},
+		},
+		{
+			name: "merger",
+			line: `[Merger] Merging formats into "Some Video [dQw4w9WgXcQ].mkv"`,
+			ok:   true,
+			want: ProgressEvent{Status: ProgressPostprocessing, Percent: 100},
+		},
+		{
+			name: "audio extraction",
+			line: "[ExtractAudio] Destination: Some Video [dQw4w9WgXcQ].mp3",
+			ok:   true,
+			want: ProgressEvent{Status: ProgressPostprocessing, Percent: 100},
+		},
+		{
+			name: "fixup",
+			line: "[FixupM3u8] Fixing MPEG-TS in MP4 container of \"Some Video.mp4\"",
+			ok:   true,
+			want: ProgressEvent{Status: ProgressPostprocessing, Percent: 100},
+		},
+		{
+			name: "subtitle embedding",
+			line: "[EmbedSubtitle] Embedding subtitles in \"Some Video.mkv\"",
+			ok:   true,
+			want: ProgressEvent{Status: ProgressPostprocessing, Percent: 100},
+		},
+		{name: "destination", line: "[download] Destination: Some Video [dQw4w9WgXcQ].f137.mp4"},
+		{name: "destination with percent in title", line: "[download] Destination: Sale (50%) off.mp4"},
+		{name: "playlist item", line: "[download] Downloading item 3 of 10"},
+		{name: "extractor", line: "[youtube] dQw4w9WgXcQ: Downloading webpage"},
+		{name: "HLS manifest", line: "[hlsnative] Downloading m3u8 manifest"},
+		{name: "HLS fragment count", line: "[hlsnative] Total fragments: 120"},
+		{name: "already downloaded", line: "[download] Some Video [dQw4w9WgXcQ].mp4 has already been downloaded"},
+		{name: "aria2c summary header", line: "*** Download Progress Summary as of Mon Jan  1 12:00:00 2024 ***"},
+		{name: "empty", line: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseProgress(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("parseProgress(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			want := tt.want
+			if want.Status == "" {
+				want.Status = ProgressDownloading
+			}
+			want.Line = tt.line
+			if got != want {
+				t.Errorf("parseProgress(%q)\n got  %+v\n want %+v", tt.line, got, want)
+			}
+		})
+	}
+}
+
+func TestParseETA(t *testing.T) {
+	tests := []struct {
+		eta  string
+		want time.Duration
+	}{
+		{"00:05", 5 * time.Second},
+		{"01:23", 83 * time.Second},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"45s", 45 * time.Second},
+		{"1m5s]", 65 * time.Second},
+		{"1h2m3s", time.Hour + 2*time.Minute + 3*time.Second},
+		{"Unknown", 0},
+		{"N/A", 0},
+		{"--:--", 0},
+	}
+	for _, tt := range tests {
+		if got := parseETA(tt.eta); got != tt.want {
+			t.Errorf("parseETA(%q) = %v, want %v", tt.eta, got, tt.want)
+		}
+	}
+}
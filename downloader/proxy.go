@@ -0,0 +1,34 @@
+package downloader
+
+import (
+	"net/http"
+	"net/url"
+
+	"yaria/config"
+)
+
+// Returns the yt-dlp --proxy args for cfg, or nil to let yt-dlp read the proxy environment
+func ProxyArgs(cfg *config.Config) []string {
+	if cfg.Proxy == "" {
+		return nil
+	}
+	return []string{"--proxy", cfg.Proxy}
+}
+
+// Returns how HTTP requests yaria makes itself find their proxy: Config.Proxy when set,
+// otherwise the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+func proxyFunc(cfg *config.Config) func(*http.Request) (*url.URL, error) {
+	if cfg.Proxy != "" {
+		if proxyURL, err := url.Parse(cfg.Proxy); err == nil {
+			return http.ProxyURL(proxyURL)
+		}
+	}
+	return http.ProxyFromEnvironment
+}
+
+// Returns an HTTP client that goes through the proxy configured for cfg
+func httpClient(cfg *config.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(cfg)
+	return &http.Client{Transport: transport}
+}
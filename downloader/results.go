@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name of the per-run results log written into playlist directories
+const ResultsFileName = "results.json"
+
+// Playlist item states recorded in the results log
+const (
+	ItemPending = "pending"
+	ItemSuccess = "success"
+	ItemFailed  = "failed"
+)
+
+// Outcome of one playlist item
+type ItemResult struct {
+	Index    int     `json:"index"`
+	URL      string  `json:"url"`
+	Title    string  `json:"title"`
+	Duration float64 `json:"duration,omitempty"`
+	Status   string  `json:"status"`
+	File     string  `json:"file,omitempty"` // Downloaded media file, relative to the playlist directory
+	Error    string  `json:"error,omitempty"`
+}
+
+// Persistent record of a playlist run
+type RunLog struct {
+	URL       string       `json:"url"`
+	Title     string       `json:"title"`
+	StartedAt time.Time    `json:"startedAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Items     []ItemResult `json:"items"`
+}
+
+// Writes the results log, replacing the file atomically
+func WriteRunLog(path string, run *RunLog) error {
+	run.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Writes an extended M3U playlist of the successfully downloaded items, in playlist order
+func WriteM3U(path string, items []ItemResult) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, item := range items {
+		if item.Status != ItemSuccess || item.File == "" {
+			continue
+		}
+		duration := int(item.Duration)
+		if duration <= 0 {
+			duration = -1
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s\n", duration, item.Title, filepath.ToSlash(item.File))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// Reads a results log written by a previous run
+func ReadRunLog(path string) (*RunLog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run RunLog
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
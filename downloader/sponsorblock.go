@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"yaria/config"
+)
+
+// SponsorBlock categories yt-dlp knows, plus its "all" and "default" aliases
+var sponsorBlockCategories = []string{
+	"sponsor", "intro", "outro", "selfpromo", "preview", "filler", "interaction",
+	"music_offtopic", "poi_highlight", "chapter", "all", "default",
+}
+
+// Categories that only point at a moment or title a chapter, so there is nothing to cut
+var markOnlyCategories = []string{"poi_highlight", "chapter"}
+
+// Checks a comma-separated SponsorBlock category list, where a leading - excludes a category
+func ValidateSponsorBlock(categories string, mark bool) error {
+	for _, category := range strings.Split(categories, ",") {
+		category = strings.TrimPrefix(strings.TrimSpace(category), "-")
+		if !slices.Contains(sponsorBlockCategories, category) {
+			return fmt.Errorf("unknown SponsorBlock category %q, expected one of %s", category, strings.Join(sponsorBlockCategories, ", "))
+		}
+		if !mark && slices.Contains(markOnlyCategories, category) {
+			return fmt.Errorf("SponsorBlock category %q can only be marked, not removed", category)
+		}
+	}
+	return nil
+}
+
+// Returns args that remove the SponsorBlock segments in cfg, or mark them as chapters
+// with SponsorBlockMark. Removal cuts extracted audio the same way it cuts videos.
+func SponsorBlockArgs(cfg *config.Config) []string {
+	if cfg.SponsorBlock == "" {
+		return nil
+	}
+	if cfg.SponsorBlockMark {
+		return []string{"--sponsorblock-mark", cfg.SponsorBlock}
+	}
+	return []string{"--sponsorblock-remove", cfg.SponsorBlock}
+}
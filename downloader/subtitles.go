@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"yaria/config"
+)
+
+// ISO 639-1 codes mapped to the 639-2 codes yt-dlp writes into embedded subtitle metadata
+var subtitleLanguages = map[string]string{
+	"ar": "ara", "cs": "ces", "da": "dan", "de": "deu", "el": "ell", "en": "eng",
+	"es": "spa", "fi": "fin", "fr": "fra", "he": "heb", "hi": "hin", "hu": "hun",
+	"id": "ind", "it": "ita", "ja": "jpn", "ko": "kor", "nl": "nld", "no": "nor",
+	"pl": "pol", "pt": "por", "ro": "ron", "ru": "rus", "sv": "swe", "th": "tha",
+	"tr": "tur", "uk": "ukr", "vi": "vie", "zh": "zho",
+}
+
+// Returns postprocessor args marking cfg.DefaultSubLang as the default subtitle track,
+// only when args embed more than one subtitle language
+func DefaultSubtitleArgs(cfg *config.Config, args []string) []string {
+	if cfg.DefaultSubLang == "" || !embedsMultipleSubs(append(SubtitleArgs(cfg), args...)) {
+		return nil
+	}
+	lang := strings.ToLower(cfg.DefaultSubLang)
+	// Region suffixes like en-US are dropped, embedded metadata only keeps the language
+	lang, _, _ = strings.Cut(lang, "-")
+	if long, ok := subtitleLanguages[lang]; ok {
+		lang = long
+	}
+	return []string{
+		"--postprocessor-args",
+		"EmbedSubtitle+ffmpeg_o:-disposition:s 0 -disposition:s:m:language:" + lang + " default",
+	}
+}
+
+// Suffix yt-dlp gives the chat replay written as a live_chat subtitle
+const liveChatSuffix = ".live_chat.json"
+
+// Returns args that write the subtitles and livestream chat replay enabled in cfg, or nil
+// when neither is. Subtitles are embedded into videos too; the chat replay is a subtitle
+// track to yt-dlp, so it shares --sub-langs but is only ever written.
+func SubtitleArgs(cfg *config.Config) []string {
+	var langs, extra []string
+	if cfg.WriteSubs {
+		subLangs := cfg.SubLangs
+		if subLangs == "" {
+			subLangs = "en"
+		}
+		langs = append(langs, subLangs)
+		if cfg.AutoSubs {
+			extra = append(extra, "--write-auto-subs")
+		}
+		if !cfg.IsAudioOnly {
+			extra = append(extra, "--embed-subs")
+		}
+	}
+	if cfg.WriteLiveChat {
+		langs = append(langs, "live_chat")
+	}
+	if len(langs) == 0 {
+		return nil
+	}
+	return append([]string{"--write-subs", "--sub-langs", strings.Join(langs, ",")}, extra...)
+}
+
+// Reports whether the file args would produce already sits in dir with a subtitle track,
+// as when a playlist is rerun, so embedding again would only duplicate tracks.
+// Items recorded in a --download-archive never get this far, yt-dlp skips them outright.
+func (d *YTDLPDownloader) subtitlesEmbedded(ctx context.Context, args []string, dir string) bool {
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return false
+	}
+	predicted, err := d.GetOutputFilename(ctx, args, dir)
+	if err != nil {
+		return false
+	}
+	path := existingOutput(filepath.Dir(predicted), filepath.Base(predicted))
+	if path == "" {
+		return false
+	}
+	output, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-select_streams", "s",
+		"-show_entries", "stream=index", "-of", "csv=p=0", path).Output()
+	return err == nil && len(bytes.TrimSpace(output)) > 0
+}
+
+// Reports whether a file is a subtitle or chat replay written next to a video
+func isSidecarFile(name string) bool {
+	if strings.HasSuffix(name, liveChatSuffix) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".vtt", ".srt", ".ass", ".ssa", ".lrc", ".ttml", ".srv1", ".srv2", ".srv3", ".json3":
+		return true
+	}
+	return false
+}
+
+// Reports whether yt-dlp args embed subtitles in more than one language
+func embedsMultipleSubs(args []string) bool {
+	embed := false
+	langs := ""
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch name {
+		case "--embed-subs":
+			embed = true
+		case "--no-embed-subs":
+			embed = false
+		case "--all-subs":
+			langs = "all"
+		case "--sub-langs", "--sub-lang", "--srt-lang", "--slang":
+			if hasValue {
+				langs = value
+			} else if i+1 < len(args) {
+				langs = args[i+1]
+			}
+		}
+	}
+	if !embed {
+		return false
+	}
+	// Regexes and "all" can match several languages
+	return langs == "all" || strings.Contains(langs, ",") || strings.ContainsAny(langs, ".*+")
+}
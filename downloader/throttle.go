@@ -0,0 +1,38 @@
+package downloader
+
+import (
+	"strconv"
+
+	"yaria/config"
+)
+
+// Returns yt-dlp sleep args spacing out requests and items of a playlist, or nil for single videos
+func SleepArgs(cfg *config.Config) []string {
+	if !cfg.IsPlaylist {
+		return nil
+	}
+	var args []string
+	if cfg.SleepInterval > 0 {
+		args = append(args, "--sleep-interval", formatSeconds(cfg.SleepInterval))
+		if cfg.MaxSleepInterval > cfg.SleepInterval {
+			args = append(args, "--max-sleep-interval", formatSeconds(cfg.MaxSleepInterval))
+		}
+	}
+	if cfg.SleepRequests > 0 {
+		args = append(args, "--sleep-requests", formatSeconds(cfg.SleepRequests))
+	}
+	return args
+}
+
+// Returns the yt-dlp --limit-rate args capping download speed, or nil when no rate limit is set
+func RateLimitArgs(cfg *config.Config) []string {
+	if cfg.RateLimit == "" {
+		return nil
+	}
+	return []string{"--limit-rate", cfg.RateLimit}
+}
+
+// Formats seconds without trailing zeros, e.g. 1.5 or 10
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ThumbnailID value that picks the thumbnail with the most pixels
+const LargestThumbnail = "largest"
+
+// One thumbnail offered by a site
+type Thumbnail struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+func (t Thumbnail) String() string {
+	size := "unknown"
+	if t.Width > 0 && t.Height > 0 {
+		size = fmt.Sprintf("%dx%d", t.Width, t.Height)
+	}
+	return fmt.Sprintf("%-6s %-11s %s", t.ID, size, t.URL)
+}
+
+// Fetches the thumbnails available for a video, what yt-dlp's --list-thumbnails shows
+func (d *YTDLPDownloader) ListThumbnails(ctx context.Context, url string) ([]Thumbnail, error) {
+	cmdArgs := []string{"--print", "%(thumbnails)j", "--no-warnings", "--no-playlist"}
+	cmdArgs = append(cmdArgs, accessArgs(d.cfg, url)...)
+	cmdArgs = append(cmdArgs, "--", url)
+	output, err := d.runQuery(ctx, false, cmdArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch thumbnails: %w", err)
+	}
+	var thumbnails []Thumbnail
+	if err := json.Unmarshal(output, &thumbnails); err != nil {
+		return nil, fmt.Errorf("failed to parse thumbnails: %v", err)
+	}
+	return thumbnails, nil
+}
+
+// Narrows the thumbnails in info to the one picked by cfg.ThumbnailID, so yt-dlp's
+// --write-thumbnail and --embed-thumbnail use it instead of their own choice
+func (d *YTDLPDownloader) selectThumbnail(info map[string]any) error {
+	thumbnails, _ := info["thumbnails"].([]any)
+	var picked map[string]any
+	bestPixels := -1.0
+	for _, t := range thumbnails {
+		thumb, _ := t.(map[string]any)
+		if thumb == nil {
+			continue
+		}
+		if d.cfg.ThumbnailID == LargestThumbnail {
+			width, _ := thumb["width"].(float64)
+			height, _ := thumb["height"].(float64)
+			if width*height > bestPixels {
+				picked, bestPixels = thumb, width*height
+			}
+		} else if fmt.Sprint(thumb["id"]) == d.cfg.ThumbnailID {
+			picked = thumb
+			break
+		}
+	}
+	if picked == nil {
+		return fmt.Errorf("no thumbnail with id %q, see --list-thumbnails", d.cfg.ThumbnailID)
+	}
+	info["thumbnails"] = []any{picked}
+	if url, ok := picked["url"].(string); ok {
+		info["thumbnail"] = url
+	}
+	return nil
+}
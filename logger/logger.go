@@ -1,11 +1,24 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Values of the log format setting
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Environment variable choosing the log format when no flag is given
+const FormatEnv = "YARIA_LOG_FORMAT"
+
 type Logger interface {
 	Info(format string, args ...any)
 	Warn(format string, args ...any)
@@ -14,6 +27,7 @@ type Logger interface {
 
 type ConsoleLogger struct {
 	logger *logrus.Logger
+	json   bool
 }
 
 func NewConsoleLogger() *ConsoleLogger {
@@ -27,14 +41,65 @@ func NewConsoleLogger() *ConsoleLogger {
 	return &ConsoleLogger{logger: logger}
 }
 
+// Logs one JSON object per line for log collectors, with a leading emoji moved
+// out of the message into an "icon" field
+func NewJSONLogger() *ConsoleLogger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(logrus.InfoLevel)
+	return &ConsoleLogger{logger: logger, json: true}
+}
+
+// Returns the logger for format, one of the Format* values, empty meaning text
+func New(format string) (*ConsoleLogger, error) {
+	switch format {
+	case "", FormatText:
+		return NewConsoleLogger(), nil
+	case FormatJSON:
+		return NewJSONLogger(), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+}
+
+// Redirects log lines, e.g. to stderr when stdout carries data
+func (l *ConsoleLogger) SetOutput(w io.Writer) {
+	l.logger.SetOutput(w)
+}
+
 func (l *ConsoleLogger) Info(format string, args ...any) {
-	l.logger.Infof(format, args...)
+	l.log(logrus.InfoLevel, format, args...)
 }
 
 func (l *ConsoleLogger) Warn(format string, args ...any) {
-	l.logger.Warnf(format, args...)
+	l.log(logrus.WarnLevel, format, args...)
 }
 
 func (l *ConsoleLogger) Error(format string, args ...any) {
-	l.logger.Errorf(format, args...)
+	l.log(logrus.ErrorLevel, format, args...)
+}
+
+func (l *ConsoleLogger) log(level logrus.Level, format string, args ...any) {
+	if !l.json {
+		l.logger.Logf(level, format, args...)
+		return
+	}
+	icon, msg := splitIcon(fmt.Sprintf(format, args...))
+	entry := logrus.NewEntry(l.logger)
+	if icon != "" {
+		entry = entry.WithField("icon", icon)
+	}
+	entry.Log(level, msg)
+}
+
+// Splits a leading emoji such as "❌ " off msg, returning it and the remaining text
+func splitIcon(msg string) (string, string) {
+	end := strings.IndexFunc(msg, func(r rune) bool {
+		// Variation selectors and joiners belong to the emoji before them
+		return !unicode.Is(unicode.So, r) && r != '\uFE0F' && r != '\u200D'
+	})
+	if end <= 0 {
+		return "", msg
+	}
+	return msg[:end], strings.TrimLeft(msg[end:], " ")
 }
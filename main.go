@@ -1,204 +1,565 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"yaria/config"
 	"yaria/downloader"
 	"yaria/logger"
+	"yaria/server"
 	"yaria/tui"
 	"yaria/utils"
 
-	"github.com/google/go-github/v62/github"
+	"golang.org/x/term"
 )
 
+// Process exit codes, documented in the README for scripts to rely on
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2
+	exitDownload    = 3
+	exitUnsupported = 4
+	exitInterrupted = 130
+)
+
+// Collects every value of a repeatable string flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
 	flag.Usage = func() {
 		log := logger.NewConsoleLogger()
 		log.Error("Error: No URL provided")
 		log.Info("Usage: yaria <URL>")
 	}
+	serveAddr := flag.String("serve", "", "Serve an HTTP download API on the given address (e.g. :8080)")
+	preferSystem := flag.Bool("prefer-system", false, "Deprecated, yt-dlp/aria2 from PATH are now used over the bundled copies by default")
+	preferBundled := flag.Bool("prefer-bundled", false, "Use the bundled yt-dlp/aria2 even when other copies are in PATH")
+	formatID := flag.String("format-id", "", "Download this exact yt-dlp format id (see yt-dlp -F), skipping the TUI")
+	batchFile := flag.String("batch-file", "", "Download every URL listed in a file, one per line (url<TAB>output-dir to override the destination)")
+	flag.StringVar(batchFile, "a", "", "Shorthand for --batch-file")
+	retryFailed := flag.String("retry-failed", "", "Re-download only the failed items from a playlist's results.json")
+	impersonate := flag.String("impersonate", "", "Impersonate a browser's TLS fingerprint, e.g. chrome (requires curl_cffi)")
+	update := flag.Bool("update", false, "Check for and install newer yt-dlp and aria2 versions now, then exit")
+	metadataOnly := flag.Bool("metadata-only", false, "Write info JSON and thumbnails for each item without downloading media")
+	direct := flag.Bool("direct", false, "Download single videos straight into the destination (resumable) instead of via a temp directory")
+	concurrentDownloads := flag.Int("concurrent-downloads", 1, fmt.Sprintf("Download up to this many URLs at once (max %d)", config.MaxURLConcurrency))
+	subs := flag.Bool("subs", false, "Download subtitles (embedded into videos), see --sub-langs")
+	subLangs := flag.String("sub-langs", "en", "Subtitle languages for --subs, e.g. \"en,de\" or \"en.*\"")
+	autoSubs := flag.Bool("write-auto-subs", false, "With --subs, also fetch auto-generated subtitles")
+	defaultSubLang := flag.String("default-sub-lang", "", "Mark this subtitle language (e.g. en) as the default track when embedding several")
+	chaptersFrom := flag.String("chapters-from", "", "Read chapters from the video's \"description\" or \"comments\" when it has none (for --embed-chapters/--split-chapters)")
+	nativeHTTP := flag.Bool("native-http", false, "Download direct media file links with the built-in HTTP downloader instead of yt-dlp")
+	noPart := flag.Bool("no-part", false, "Write downloads directly to the final filename instead of .part files")
+	dateFolders := flag.Bool("date-folders", false, "Sort downloads into YYYY/MM folders by upload date")
+	writeM3U := flag.Bool("m3u", false, "Write an .m3u8 playlist file of the downloaded items into the playlist folder")
+	audioFallback := flag.Bool("audio-fallback", false, "Download audio without asking when a video has only audio formats")
+	maxFilesizeAbort := flag.String("max-filesize-abort", "", "Abort and clean up a download once it grows past this size (e.g. 500M, 2G)")
+	albumMode := flag.Bool("album", false, "Tag audio playlist downloads as an album (album = playlist title, track = playlist index)")
+	noPreflight := flag.Bool("no-preflight", false, "Skip the connectivity check before downloading")
+	waitForVideo := flag.String("wait-for-video", "", "Wait for scheduled premieres to go live, retrying every MIN[-MAX] seconds")
+	liveChat := flag.Bool("live-chat", false, "Save the chat replay of archived livestreams as a .live_chat.json file")
+	normalizeAudio := flag.Bool("normalize-audio", false, "Normalize loudness of extracted audio (ffmpeg loudnorm, requires ffmpeg)")
+	var postprocessorArgs stringList
+	flag.Var(&postprocessorArgs, "postprocessor-args", "Pass NAME:ARGS to yt-dlp's --postprocessor-args, e.g. \"Merger+ffmpeg_o:-movflags +faststart\" (repeatable)")
+	sleepInterval := flag.Float64("sleep-interval", 0, "Seconds to wait before each playlist item")
+	maxSleepInterval := flag.Float64("max-sleep-interval", 0, "Wait a random time between --sleep-interval and this many seconds instead")
+	sleepRequests := flag.Float64("sleep-requests", 0, "Seconds to wait between extraction requests in a playlist")
+	outputPipe := flag.String("output-pipe", "", "Stream the download into a named pipe at this path for another program to read")
+	maxConsecutiveFailures := flag.Int("max-consecutive-failures", 5, "Abort a playlist after this many items fail in a row (0 to never abort)")
+	audioOnly := flag.Bool("audio", false, "Download audio only, skipping the TUI")
+	resolution := flag.String("resolution", "", "Download this video format id, or a max height like 1080p, skipping the TUI")
+	audioFormat := flag.String("audio-format", "", "Audio format for --audio: best, aac, alac, flac, m4a, mp3, opus, vorbis or wav")
+	outputTemplate := flag.String("o", "", "Output filename template (yt-dlp syntax), e.g. \"%(uploader)s - %(title)s.%(ext)s\"")
+	benchmark := flag.String("benchmark", "", "Download a URL once with aria2c and once with yt-dlp's native downloader and compare their speed")
+	concurrentFragments := flag.String("concurrent-fragments", "", "Fragments to fetch in parallel for HLS/DASH, or \"auto\" to size them from CPU count and measured bandwidth")
+	commandTimeout := flag.Duration("command-timeout", 0, "Give up on yt-dlp metadata queries after this long, e.g. 90s (default 60s, or command_timeout from the config file)")
+	defaultFormat := flag.String("default-format", "", "Format expression used when no resolution is picked, e.g. \"bv*[height<=1080][vcodec^=avc1]+ba[ext=m4a]/b[ext=mp4]\"")
+	embedThumbnail := flag.Bool("embed-thumbnail", false, "Embed the thumbnail as cover art (not for aac or wav audio)")
+	embedMetadata := flag.Bool("embed-metadata", false, "Embed title, artist and other tags into the output file (not for aac or wav audio)")
+	sponsorBlock := flag.String("sponsorblock", "", "Remove these SponsorBlock segments, e.g. \"sponsor,intro\" or \"all\" (also cut from --audio downloads)")
+	sponsorBlockMark := flag.Bool("sponsorblock-mark", false, "Mark --sponsorblock segments as chapters instead of removing them")
+	listThumbnails := flag.Bool("list-thumbnails", false, "List the thumbnails of a URL with their ids for --thumbnail-id, then exit")
+	dumpJSON := flag.Bool("dump-json", false, "Print the full yt-dlp info JSON of a URL to stdout without downloading, then exit")
+	thumbnailID := flag.String("thumbnail-id", "", "Thumbnail to write or embed (--write-thumbnail/--embed-thumbnail): an id from --list-thumbnails, or \"largest\"")
+	audioMultistreams := flag.Bool("audio-multistreams", false, "Allow --format-id to merge several audio streams, e.g. \"137+140+251\" for main and commentary tracks")
+	videoMultistreams := flag.Bool("video-multistreams", false, "Allow --format-id to merge several video streams")
+	nice := flag.Int("nice", 0, "Run downloads at this niceness, from -20 (highest priority) to 19 (lowest), e.g. 10 for background archiving")
+	mergeOutputFormat := flag.String("merge-output-format", "", "Write merged videos as this container (mkv, mp4, webm, ...) so the output filename is known up front")
+	formatProbe := flag.Int("concurrent-format-probe", 4, "List formats of up to this many URLs in the background while the TUI loads metadata, 0 to disable")
+	perDownloadLimit := flag.String("per-download-limit", "", "Cap each aria2c download (every file or fragment) at this speed, e.g. 500K or 2M")
+	overallLimit := flag.String("overall-limit", "", "Cap the combined speed of each aria2c run, e.g. 2M")
+	rateLimit := flag.String("limit-rate", "", "Cap download speed on metered connections, e.g. 2M or 500K, using fewer connections")
+	flag.StringVar(rateLimit, "r", "", "Shorthand for --limit-rate")
+	playlistItems := flag.String("items", "", "Only download these playlist items, e.g. \"1-5,8,10-12\"")
+	ytDlpPath := flag.String("yt-dlp-path", "", "Run this yt-dlp executable instead of the one on PATH or in the dependencies folder")
+	proxy := flag.String("proxy", "", "Route yt-dlp, aria2c and dependency downloads through this proxy, e.g. http://proxy:3128 or socks5://127.0.0.1:1080")
+	onExisting := flag.String("on-existing", "", "When the output file already exists: skip (default), overwrite, rename or error")
+	trimFilenames := flag.Int("trim-filenames", 0, "Limit filenames to this many characters (0 for no limit)")
+	cookiesFile := flag.String("cookies", "", "Load cookies from a Netscape-format cookies.txt (takes precedence over --cookies-from-browser)")
+	cookiesFromBrowser := flag.String("cookies-from-browser", "", "Load cookies from browser[+keyring][:profile][::container]")
+	logFormat := flag.String("log-format", "", "Log as text (default) or json, one object per line for log collectors (or set YARIA_LOG_FORMAT)")
 	flag.Parse()
 
 	args := flag.Args()
-	cfg := config.New()
-	log := logger.NewConsoleLogger()
-	tuiInstance := tui.New(cfg, log)
-
-	// Initialize dependencies directory
-	exePath, err := os.Executable()
+	cfg, warnings := config.New()
+	if *logFormat == "" {
+		*logFormat = os.Getenv(logger.FormatEnv)
+	}
+	log, err := logger.New(*logFormat)
 	if err != nil {
-		exePath, _ = os.Getwd()
-	}
-	depsDir := filepath.Join(filepath.Dir(exePath), "dependencies")
-	if err := os.MkdirAll(depsDir, 0o755); err != nil {
-		log.Error("Error: Failed to create dependencies directory: %v", err)
-		os.Exit(1)
-	}
-
-	// Setup yt-dlp
-	ytDlpBinary := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpBinary = "yt-dlp.exe"
-	}
-	ytDlpPath := filepath.Join(depsDir, ytDlpBinary)
-	if _, err := exec.LookPath(ytDlpBinary); err != nil {
-		if _, err := os.Stat(ytDlpPath); err != nil {
-			log.Info("⬇️ Downloading yt-dlp from GitHub...")
-			client := github.NewClient(nil)
-			release, _, err := client.Repositories.GetLatestRelease(context.Background(), "yt-dlp", "yt-dlp")
-			if err != nil {
-				log.Error("Error: Failed to fetch yt-dlp release: %v", err)
-				os.Exit(1)
-			}
-			var downloadURL string
-			for _, asset := range release.Assets {
-				if asset.GetName() == ytDlpBinary {
-					downloadURL = asset.GetBrowserDownloadURL()
-					break
-				}
-			}
-			if downloadURL == "" {
-				log.Error("Error: No suitable yt-dlp binary found")
-				os.Exit(1)
-			}
-			resp, err := http.Get(downloadURL)
-			if err != nil {
-				log.Error("Error: Failed to download yt-dlp: %v", err)
-				os.Exit(1)
-			}
-			defer resp.Body.Close()
-			if resp.StatusCode != http.StatusOK {
-				log.Error("Error: Failed to download yt-dlp: HTTP status %s", resp.Status)
-				os.Exit(1)
-			}
-			out, err := os.Create(ytDlpPath)
-			if err != nil {
-				log.Error("Error: Failed to create yt-dlp binary: %v", err)
-				os.Exit(1)
-			}
-			_, err = io.Copy(out, resp.Body)
-			out.Close()
-			if err != nil {
-				log.Error("Error: Failed to save yt-dlp: %v", err)
-				os.Exit(1)
-			}
-			if runtime.GOOS != "windows" {
-				if err := os.Chmod(ytDlpPath, 0o755); err != nil {
-					log.Error("Error: Failed to set permissions for yt-dlp: %v", err)
-					os.Exit(1)
-				}
-			}
-			log.Info("Downloaded yt-dlp to %s", ytDlpPath)
-		} else {
-			log.Info("Found yt-dlp in dependencies at %s", ytDlpPath)
+		log = logger.NewConsoleLogger()
+		log.Error("Error: --log-format: %v", err)
+		os.Exit(exitUsage)
+	}
+	for _, warning := range warnings {
+		log.Warn("Warning: %s", warning)
+	}
+	if *dumpJSON {
+		// Keep stdout clean JSON for other tools to parse
+		log.SetOutput(os.Stderr)
+		cfg.Stdout = os.Stderr
+	}
+
+	cfg.PreferBundled = *preferBundled && !*preferSystem
+	cfg.DirectDownload = *direct
+	cfg.NativeHTTP = *nativeHTTP
+	cfg.NoPart = *noPart
+	cfg.WriteM3U = *writeM3U
+	if *dateFolders {
+		cfg.DateFolders = true
+	}
+	cfg.AudioFallback = *audioFallback
+	cfg.AlbumMode = *albumMode
+	cfg.PreflightCheck = !*noPreflight
+	cfg.ForceUpdate = *update
+	cfg.AudioNormalize = *normalizeAudio
+	cfg.WriteLiveChat = *liveChat
+	cfg.WriteSubs = *subs
+	cfg.SubLangs = strings.TrimSpace(*subLangs)
+	cfg.AutoSubs = *autoSubs
+	cfg.EmbedThumbnail = *embedThumbnail
+	cfg.EmbedMetadata = *embedMetadata
+	cfg.PostprocessorArgs = postprocessorArgs
+	if err := cfg.ValidatePostprocessorArgs(); err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	if *sleepInterval < 0 || *maxSleepInterval < 0 || *sleepRequests < 0 {
+		log.Error("Error: sleep intervals can't be negative")
+		os.Exit(exitUsage)
+	}
+	if *maxSleepInterval > 0 && (*sleepInterval == 0 || *maxSleepInterval < *sleepInterval) {
+		log.Error("Error: --max-sleep-interval needs a --sleep-interval no larger than it")
+		os.Exit(exitUsage)
+	}
+	if *maxConsecutiveFailures < 0 {
+		log.Error("Error: --max-consecutive-failures must not be negative")
+		os.Exit(exitUsage)
+	}
+	cfg.MaxFailStreak = *maxConsecutiveFailures
+	cfg.SleepInterval = *sleepInterval
+	cfg.MaxSleepInterval = *maxSleepInterval
+	cfg.SleepRequests = *sleepRequests
+	if *waitForVideo != "" {
+		if !regexp.MustCompile(`^\d+(-\d+)?$`).MatchString(*waitForVideo) {
+			log.Error("Error: --wait-for-video must be MIN or MIN-MAX seconds")
+			os.Exit(exitUsage)
 		}
-	} else {
-		log.Info("Found yt-dlp in system PATH")
-	}
-
-	// Setup aria2
-	aria2Binary := "aria2c"
-	if runtime.GOOS == "windows" {
-		aria2Binary = "aria2c.exe"
-	}
-	aria2Path := filepath.Join(depsDir, aria2Binary)
-	if _, err := exec.LookPath(aria2Binary); err != nil {
-		if _, err := os.Stat(aria2Path); err != nil {
-			log.Info("Downloading aria2 from GitHub...")
-			client := github.NewClient(nil)
-			release, _, err := client.Repositories.GetLatestRelease(context.Background(), "aria2", "aria2")
-			if err != nil {
-				log.Warn("Warning: Failed to fetch aria2 release: %v", err)
-				cfg.UseAria2c = false
-			} else {
-				assetPattern := fmt.Sprintf("aria2-[0-9.]+-%s-%s", runtime.GOOS, runtime.GOARCH)
-				var downloadURL string
-				for _, asset := range release.Assets {
-					if strings.Contains(asset.GetName(), assetPattern) && !strings.Contains(asset.GetName(), ".tar.") && !strings.Contains(asset.GetName(), ".zip") {
-						downloadURL = asset.GetBrowserDownloadURL()
-						break
-					}
-				}
-				if downloadURL == "" {
-					log.Warn("Warning: No suitable aria2 binary found")
-					cfg.UseAria2c = false
-				} else {
-					resp, err := http.Get(downloadURL)
-					if err != nil {
-						log.Warn("Warning: Failed to download aria2: %v", err)
-						cfg.UseAria2c = false
-					} else {
-						defer resp.Body.Close()
-						if resp.StatusCode != http.StatusOK {
-							log.Warn("Warning: Failed to download aria2: HTTP status %s", resp.Status)
-							cfg.UseAria2c = false
-						} else {
-							out, err := os.Create(aria2Path)
-							if err != nil {
-								log.Warn("Warning: Failed to create aria2 binary: %v", err)
-								cfg.UseAria2c = false
-							} else {
-								_, err = io.Copy(out, resp.Body)
-								out.Close()
-								if err != nil {
-									log.Warn("Warning: Failed to save aria2: %v", err)
-									cfg.UseAria2c = false
-								} else if runtime.GOOS != "windows" {
-									if err := os.Chmod(aria2Path, 0o755); err != nil {
-										log.Warn("Warning: Failed to set permissions for aria2: %v", err)
-										cfg.UseAria2c = false
-									} else {
-										log.Info("Downloaded aria2 to %s", aria2Path)
-										cfg.UseAria2c = true
-									}
-								} else {
-									log.Info("Downloaded aria2 to %s", aria2Path)
-									cfg.UseAria2c = true
-								}
-							}
-						}
-					}
-				}
-			}
-		} else {
-			log.Info("Found aria2 in dependencies at %s", aria2Path)
-			cfg.UseAria2c = true
+		cfg.WaitForVideo = *waitForVideo
+	}
+	if *audioOnly && *resolution != "" {
+		log.Error("Error: --audio and --resolution can't be combined")
+		os.Exit(exitUsage)
+	}
+	if (*audioOnly || *resolution != "") && len(args) == 0 {
+		log.Error("Error: --audio and --resolution require a URL")
+		os.Exit(exitUsage)
+	}
+	cfg.IsAudioOnly = *audioOnly
+	if *resolution != "" {
+		cfg.Resolution = config.ResolutionFormat(strings.TrimSpace(*resolution))
+	}
+	if *audioFormat != "" {
+		if !slices.Contains(config.AudioFormats, *audioFormat) {
+			log.Error("Error: --audio-format must be one of %s", strings.Join(config.AudioFormats, ", "))
+			os.Exit(exitUsage)
+		}
+		cfg.AudioFormat = *audioFormat
+	}
+	if *outputTemplate != "" {
+		cfg.OutputTemplate = *outputTemplate
+	}
+	if *defaultFormat != "" {
+		cfg.DefaultFormat = *defaultFormat
+	}
+	if *commandTimeout > 0 {
+		cfg.CommandTimeout = *commandTimeout
+	}
+	if *concurrentFragments != "" {
+		if n, err := strconv.Atoi(*concurrentFragments); *concurrentFragments != config.AutoFragments && (err != nil || n <= 0) {
+			log.Error("Error: --concurrent-fragments must be a positive number or %q", config.AutoFragments)
+			os.Exit(exitUsage)
+		}
+		cfg.ConcurrentFragments = *concurrentFragments
+	}
+	cfg.ThumbnailID = strings.TrimSpace(*thumbnailID)
+	if *sponsorBlock != "" {
+		if err := downloader.ValidateSponsorBlock(*sponsorBlock, *sponsorBlockMark); err != nil {
+			log.Error("Error: --sponsorblock: %v", err)
+			os.Exit(exitUsage)
+		}
+		cfg.SponsorBlock = strings.ReplaceAll(*sponsorBlock, " ", "")
+	}
+	cfg.SponsorBlockMark = *sponsorBlockMark
+	if *listThumbnails && len(args) == 0 {
+		log.Error("Error: --list-thumbnails requires a URL")
+		os.Exit(exitUsage)
+	}
+	if *dumpJSON && len(args) == 0 {
+		log.Error("Error: --dump-json requires a URL")
+		os.Exit(exitUsage)
+	}
+	cfg.QueryOnly = *metadataOnly || *listThumbnails || *dumpJSON || downloader.IsQueryOnly(args)
+	if *maxFilesizeAbort != "" {
+		size, err := utils.ParseSize(*maxFilesizeAbort)
+		if err != nil || size <= 0 {
+			log.Error("Error: invalid --max-filesize-abort value %q", *maxFilesizeAbort)
+			os.Exit(exitUsage)
+		}
+		cfg.MaxFilesize = size
+	}
+	cfg.DefaultSubLang = strings.TrimSpace(*defaultSubLang)
+	switch *chaptersFrom {
+	case "", downloader.ChaptersFromDescription, downloader.ChaptersFromComments:
+		cfg.ChaptersFrom = *chaptersFrom
+	default:
+		log.Error("Error: --chapters-from must be %q or %q", downloader.ChaptersFromDescription, downloader.ChaptersFromComments)
+		os.Exit(exitUsage)
+	}
+	if *mergeOutputFormat != "" {
+		cfg.MergeOutputFormat = *mergeOutputFormat
+	}
+	if cfg.MergeOutputFormat != "" {
+		if err := downloader.ValidateMergeFormat(cfg.MergeOutputFormat); err != nil {
+			log.Error("Error: --merge-output-format: %v", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *formatProbe < 0 {
+		log.Error("Error: --concurrent-format-probe must not be negative")
+		os.Exit(exitUsage)
+	}
+	cfg.FormatProbeConcurrency = *formatProbe
+	if *perDownloadLimit != "" {
+		cfg.PerDownloadLimit = *perDownloadLimit
+	}
+	if *overallLimit != "" {
+		cfg.OverallDownloadLimit = *overallLimit
+	}
+	if *rateLimit != "" {
+		cfg.RateLimit = *rateLimit
+	}
+	if err := cfg.ValidateDownloadLimits(); err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	if *playlistItems != "" {
+		if err := downloader.ValidatePlaylistItems(*playlistItems); err != nil {
+			log.Error("Error: --items: %v", err)
+			os.Exit(exitUsage)
+		}
+		cfg.PlaylistItems = strings.ReplaceAll(*playlistItems, " ", "")
+	}
+	if *ytDlpPath != "" {
+		cfg.YTDLPPath = *ytDlpPath
+	}
+	cfg.YTDLPPath = utils.ExpandHome(cfg.YTDLPPath)
+	if err := cfg.ValidateYTDLPPath(); err != nil {
+		log.Error("Error: --yt-dlp-path: %v", err)
+		os.Exit(exitUsage)
+	}
+	if *proxy != "" {
+		cfg.Proxy = *proxy
+	}
+	if err := cfg.ValidateProxy(); err != nil {
+		log.Error("Error: --proxy: %v", err)
+		os.Exit(exitUsage)
+	}
+	if *onExisting != "" {
+		cfg.OnExisting = *onExisting
+	}
+	if err := cfg.ValidateOnExisting(); err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	cfg.Impersonate = strings.TrimSpace(*impersonate)
+	cfg.AudioMultistreams = *audioMultistreams
+	cfg.VideoMultistreams = *videoMultistreams
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "format-id" {
+			return
+		}
+		if strings.TrimSpace(*formatID) == "" {
+			log.Error("Error: --format-id must not be empty")
+			os.Exit(exitUsage)
+		}
+		if len(args) == 0 {
+			log.Error("Error: --format-id requires a URL")
+			os.Exit(exitUsage)
+		}
+		cfg.Resolution = strings.TrimSpace(*formatID)
+		cfg.RawFormat = true
+	})
+	if *trimFilenames < 0 {
+		log.Error("Error: --trim-filenames must not be negative")
+		os.Exit(exitUsage)
+	}
+	cfg.TrimFilenames = *trimFilenames
+	if *nice < -20 || *nice > 19 {
+		log.Error("Error: --nice must be between -20 and 19")
+		os.Exit(exitUsage)
+	}
+	cfg.Nice = *nice
+	if *concurrentDownloads < 1 {
+		log.Error("Error: --concurrent-downloads must be at least 1")
+		os.Exit(exitUsage)
+	}
+	cfg.URLConcurrency = *concurrentDownloads
+	if cfg.URLConcurrency > config.MaxURLConcurrency {
+		log.Warn("Warning: --concurrent-downloads capped at %d", config.MaxURLConcurrency)
+		cfg.URLConcurrency = config.MaxURLConcurrency
+	}
+	if *outputPipe != "" && len(args) == 0 {
+		log.Error("Error: --output-pipe requires a URL")
+		os.Exit(exitUsage)
+	}
+	if *metadataOnly && len(args) == 0 {
+		log.Error("Error: --metadata-only requires a URL")
+		os.Exit(exitUsage)
+	}
+	if *cookiesFromBrowser != "" {
+		cfg.CookieBrowser = *cookiesFromBrowser
+	}
+	if *cookiesFile != "" {
+		cfg.CookieFile = *cookiesFile
+	}
+	// Also covers cookies set in the config file
+	cfg.CookieFile = utils.ExpandHome(cfg.CookieFile)
+	if err := cfg.ValidateCookieFile(); err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	if cfg.CookieFile != "" && cfg.CookieBrowser != "" {
+		log.Warn("Warning: Both a cookies file and a cookie browser are set, using %s", cfg.CookieFile)
+	}
+	if err := cfg.ValidateCookieBrowser(); err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitUsage)
+	}
+	tuiInstance := tui.New(cfg, log)
+
+	// Update mode - recheck dependencies right away and report what changed
+	depsDir := utils.ResolveDepsDir(cfg.DepsDir)
+	dependencies := []string{"yt-dlp", "aria2"}
+	before := make(map[string]string)
+	if *update {
+		for _, name := range dependencies {
+			before[name] = downloader.DependencyVersion(depsDir, name)
 		}
-	} else {
-		log.Info("Found aria2 in system PATH")
-		cfg.UseAria2c = true
 	}
 
-	// Update PATH
-	currentPath := os.Getenv("PATH")
-	newPath := depsDir + string(os.PathListSeparator) + currentPath
-	if err := os.Setenv("PATH", newPath); err != nil {
-		log.Error("Error: Failed to update PATH: %v", err)
-		os.Exit(1)
+	// Fetch missing or outdated yt-dlp and aria2, and put the dependencies folder on PATH.
+	// Ctrl+C stops a stalled download here instead of waiting for it to time out.
+	depsCtx, stopDeps := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = downloader.EnsureDependencies(depsCtx, cfg)
+	stopDeps()
+	if err != nil {
+		log.Error("Error: %v", err)
+		os.Exit(exitCode(err))
 	}
 
 	// Initialize downloader
 	dl, err := downloader.New(cfg)
 	if err != nil {
 		log.Error("Error: %v", err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+	if *update {
+		for _, name := range dependencies {
+			after := downloader.DependencyVersion(depsDir, name)
+			switch {
+			case after == "":
+				log.Warn("%s: not installed", name)
+			case before[name] == after:
+				log.Info("%s: %s (up to date)", name, after)
+			case before[name] == "":
+				log.Info("%s: installed %s", name, after)
+			default:
+				log.Info("%s: %s -> %s", name, before[name], after)
+			}
+		}
+		os.Exit(exitOK)
 	}
 	tuiInstance.SetDownloader(dl)
+	// Bounded by the command timeout, Ctrl+C stops a yt-dlp that doesn't answer
+	checkCtx, stopCheck := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = dl.CheckImpersonate(checkCtx)
+	stopCheck()
+	if errors.Is(err, context.Canceled) {
+		os.Exit(exitInterrupted)
+	} else if err != nil {
+		log.Warn("Warning: %v", err)
+	}
+	if cfg.AudioNormalize && !downloader.HasFFmpeg() {
+		log.Warn("Warning: --normalize-audio requires ffmpeg, which was not found; audio will not be normalized")
+	}
+	if warning := downloader.EmbedWarning(cfg); warning != "" {
+		log.Warn("Warning: %s", warning)
+	}
 
 	originalDir, err := os.Getwd()
 	if err != nil {
 		log.Error("Error: Failed to get current directory: %v", err)
-		os.Exit(1)
+		os.Exit(exitError)
+	}
+	// Downloads land in DownloadLocation when set, otherwise the working directory
+	destDir := originalDir
+	if cfg.DownloadLocation != "" {
+		cfg.DownloadLocation = utils.ExpandHome(cfg.DownloadLocation)
+		if err := os.MkdirAll(cfg.DownloadLocation, 0o755); err != nil {
+			log.Error("Error: Failed to create download location %s: %v", cfg.DownloadLocation, err)
+			os.Exit(exitError)
+		}
+		destDir = cfg.DownloadLocation
+	}
+
+	// Server mode - expose the download API instead of downloading directly
+	if *serveAddr != "" {
+		srv := server.New(cfg, dl, log, destDir)
+		log.Info("Serving download API on %s", *serveAddr)
+		if err := srv.ListenAndServe(*serveAddr); err != nil {
+			log.Error("Error: Server stopped: %v", err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	}
+
+	// Ctrl+C or SIGTERM stops the running yt-dlp, letting the download clean up its temp dir
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Retry mode - re-attempt failed items from a previous playlist run
+	if *retryFailed != "" {
+		client := downloader.NewClient(dl, log)
+		result := client.RetryFailed(ctx, *retryFailed, args)
+		exitIfInterrupted(ctx, log)
+		if result.Err != nil {
+			log.Error("❌ Error: %v", result.Err)
+			os.Exit(exitCode(result.Err))
+		}
+		os.Exit(exitOK)
+	}
+
+	// Benchmark mode - compare aria2c with the native downloader, keeping nothing. The URL is the
+	// flag value, so this runs before the stdin fallback waits for URLs.
+	if *benchmark != "" {
+		results, err := dl.Benchmark(ctx, *benchmark)
+		exitIfInterrupted(ctx, log)
+		if err != nil {
+			log.Error("Error: %v", err)
+			os.Exit(exitError)
+		}
+		for _, result := range results {
+			log.Info("%s", result)
+		}
+		os.Exit(exitOK)
+	}
+
+	// Without a terminal the TUI can't run, so take URLs from stdin and continue headless
+	if len(args) == 0 && *batchFile == "" {
+		if err := tui.CheckTTY(); err != nil {
+			log.Warn("Warning: %v, running without the TUI", err)
+			args = readURLs(os.Stdin)
+			if len(args) == 0 {
+				log.Error("Error: No URL provided, pass one as an argument or on stdin")
+				os.Exit(exitUsage)
+			}
+		}
+	}
+
+	// Batch mode - download a batch file, or several URLs given on the command line
+	var entries []downloader.BatchEntry
+	extraArgs := args
+	if *batchFile != "" {
+		fileEntries, err := downloader.ReadBatchFile(*batchFile)
+		if err != nil {
+			log.Error("Error: Failed to read batch file: %v", err)
+			os.Exit(exitError)
+		}
+		for _, entry := range fileEntries {
+			if !downloader.LooksLikeURL(entry.URL) {
+				log.Warn("Warning: Skipping %q in %s, not a URL", entry.URL, *batchFile)
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			log.Error("Error: No URLs found in %s", *batchFile)
+			os.Exit(exitUsage)
+		}
+	}
+	// URLs on the command line join the batch file, or form a batch of their own
+	if urls, flags := splitURLs(args); *batchFile != "" || len(urls) > 1 {
+		for _, u := range urls {
+			entries = append(entries, downloader.BatchEntry{URL: u})
+		}
+		extraArgs = flags
+	}
+	if len(entries) > 0 {
+		client := downloader.NewClient(dl, log)
+		succeeded, skipped, failed := 0, 0, 0
+		code := exitOK
+		results := client.FetchAll(ctx, entries, extraArgs, destDir, cfg.URLConcurrency)
+		exitIfInterrupted(ctx, log)
+		for _, result := range results {
+			switch {
+			case result.Err != nil:
+				log.Error("❌ Error: %s: %v", result.URL, result.Err)
+				code = max(code, exitCode(result.Err))
+				failed++
+			case result.Skipped:
+				skipped++
+			default:
+				succeeded++
+			}
+		}
+		log.Info("Summary: %d succeeded, %d skipped, %d failed of %d URLs", succeeded, skipped, failed, len(entries))
+		os.Exit(code)
 	}
 
 	var url string
@@ -211,15 +572,57 @@ func main() {
 		dl, err := downloader.New(cfg)
 		if err != nil {
 			log.Error("Error: Failed to initialize downloader: %v", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 
 		// Stream torrent with mpv or vlc
 		if err := dl.StreamTorrent(args[0]); err != nil {
 			log.Error("Error: Failed to stream torrent: %v", err)
-			os.Exit(1)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
+	}
+
+	// Thumbnail listing mode - show what --thumbnail-id can pick from
+	if *listThumbnails {
+		thumbnails, err := dl.ListThumbnails(ctx, args[0])
+		exitIfInterrupted(ctx, log)
+		if err != nil {
+			log.Error("Error: %v", err)
+			os.Exit(exitError)
+		}
+		log.Info("%-6s %-11s %s", "ID", "SIZE", "URL")
+		for _, thumbnail := range thumbnails {
+			log.Info("%s", thumbnail)
 		}
-		os.Exit(0)
+		os.Exit(exitOK)
+	}
+
+	// Info dump mode - print the raw info JSON, indented when read by a person
+	if *dumpJSON {
+		data, err := dl.DumpJSON(ctx, args[0])
+		exitIfInterrupted(ctx, log)
+		if err != nil {
+			log.Error("Error: %v", err)
+			os.Exit(exitCode(err))
+		}
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			var pretty bytes.Buffer
+			if err := json.Indent(&pretty, data, "", "  "); err == nil {
+				data = pretty.Bytes()
+			}
+		}
+		os.Stdout.Write(append(bytes.TrimSpace(data), '\n'))
+		os.Exit(exitOK)
+	}
+
+	// Pipe mode - stream into a FIFO instead of saving a file
+	if *outputPipe != "" {
+		if err := dl.StreamToPipe(args, *outputPipe); err != nil {
+			log.Error("Error: %v", err)
+			os.Exit(exitError)
+		}
+		os.Exit(exitOK)
 	}
 
 	// SINGLE TUI RUN - Run TUI twice: first for selection, then for download
@@ -227,15 +630,15 @@ func main() {
 		// First run: Get URL, format, and resolution
 		if err := tuiInstance.Run("", ""); err != nil {
 			log.Error("Error: Failed to run TUI: %v", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		// Check if TUI exited with an error message or user cancelled
 		if tuiInstance.URL == "" {
-			os.Exit(0)
+			os.Exit(exitInterrupted)
 		}
 		if !tuiInstance.Confirmed {
 			log.Info("Download cancelled")
-			os.Exit(0)
+			os.Exit(exitInterrupted)
 		}
 		url = tuiInstance.URL
 		args = []string{url}
@@ -244,30 +647,30 @@ func main() {
 		videoTitle = tuiInstance.Title
 		// If playlistInfo is empty, TUI exited with error
 		if playlistInfo == "" {
-			os.Exit(0)
+			os.Exit(exitError)
 		}
 
 		// Determine playlist or single video
 		parts := utils.SplitN(playlistInfo, "&", 3)
 		if len(parts) < 3 {
 			log.Error("Error: Invalid metadata format")
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 		isPlaylist := parts[0]
 		playlistTitle := parts[1]
 		playlistCountStr := parts[2]
 
-		isSingleVideo := isPlaylist == "NA" || utils.MustParseInt(playlistCountStr) <= 1
+		isSingleVideo := isPlaylist == "NA" || downloader.PlaylistItemsCount(cfg.PlaylistItems, utils.MustParseInt(playlistCountStr)) <= 1
 
 		// Generate final name
 		var finalName string
 		if isSingleVideo {
-			finalName = utils.SanitizeFilename(videoTitle)
+			finalName = utils.TrimFilename(utils.SanitizeFilename(videoTitle), cfg.TrimFilenames)
 			if finalName == "" {
 				finalName = utils.GenerateTempDirName("Video")
 			}
 		} else {
-			finalName = utils.SanitizeFilename(playlistTitle)
+			finalName = utils.TrimFilename(utils.SanitizeFilename(playlistTitle), cfg.TrimFilenames)
 			if finalName == "" {
 				finalName = utils.GenerateTempDirName("Playlist")
 			}
@@ -280,98 +683,76 @@ func main() {
 		// Second run: Show download progress in TUI (skip confirmation)
 		if err := tuiInstance.RunDownloadOnly(); err != nil {
 			log.Error("Error: Failed to run TUI download: %v", err)
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 
 		// TUI handled everything including download
-		os.Exit(0)
+		os.Exit(exitCode(tuiInstance.DownloadErr))
 	}
 
 	// CLI MODE - fetch metadata and download
-	url = args[0]
-	playlistInfo, videoTitle, err = dl.GetMetadata(args)
-	if err != nil {
-		log.Error("Error: Failed to fetch metadata: %v", err)
-		os.Exit(1)
+	client := downloader.NewClient(dl, log)
+	var result downloader.Result
+	if *metadataOnly {
+		result = client.Catalog(ctx, args[0], destDir)
+	} else {
+		result = client.Fetch(ctx, args, destDir)
 	}
-
-	// Determine playlist or single video
-	parts := utils.SplitN(playlistInfo, "&", 3)
-	if len(parts) < 3 {
-		log.Error("Error: Invalid metadata format")
-		os.Exit(1)
+	exitIfInterrupted(ctx, log)
+	if result.Err != nil {
+		log.Error("❌ Error: %v", result.Err)
+		os.Exit(exitCode(result.Err))
 	}
-	isPlaylist := parts[0]
-	playlistTitle := parts[1]
-	playlistCountStr := parts[2]
-
-	isSingleVideo := isPlaylist == "NA" || utils.MustParseInt(playlistCountStr) <= 1
+}
 
-	// Generate final name and check duplicates
-	var finalName string
-	if isSingleVideo {
-		finalName = utils.SanitizeFilename(videoTitle)
-		if finalName == "" {
-			finalName = utils.GenerateTempDirName("Video")
-		}
-		videoFileName := finalName + ".mp4"
-		destPath := filepath.Join(originalDir, videoFileName)
-		if utils.FileExists(destPath) {
-			log.Warn("Video already exists: %s, skipping download", videoFileName)
-			os.Exit(0)
-		}
-	} else {
-		finalName = utils.SanitizeFilename(playlistTitle)
-		if finalName == "" {
-			finalName = utils.GenerateTempDirName("Playlist")
-		}
+// Maps an error to the exit code scripts can tell it apart by
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, downloader.ErrDRMProtected), errors.Is(err, downloader.ErrUnsupportedURL):
+		return exitUnsupported
+	case errors.Is(err, downloader.ErrDownloadFailed), errors.Is(err, downloader.ErrItemsFailed),
+		errors.Is(err, downloader.ErrTooManyFailures), errors.As(err, &exitErr):
+		return exitDownload
+	default:
+		return exitError
 	}
+}
 
-	// Create unique temp directory
-	tempDir, err := utils.CreateUniqueTempDir(finalName)
-	if err != nil {
-		log.Error("Failed to create directory: %s: %v", tempDir, err)
-		os.Exit(1)
+// Exits with the shell's status for SIGINT once a signal has cancelled ctx
+func exitIfInterrupted(ctx context.Context, log logger.Logger) {
+	if ctx.Err() != nil {
+		log.Warn("Download interrupted")
+		os.Exit(exitInterrupted)
 	}
-	defer func() {
-		if isSingleVideo && utils.FileExists(tempDir) {
-			_ = os.RemoveAll(tempDir)
-		}
-	}()
+}
 
-	// Download (CLI mode only)
-	log.Info("Starting download...")
-	fmt.Println() // Add blank line for separation
-	success, err := dl.Download(args, tempDir)
-	if err != nil {
-		log.Error("❌ Download failed: %v", err)
-		_ = os.RemoveAll(tempDir)
-		os.Exit(1)
-	}
-	if !success {
-		log.Error("All download attempts failed")
-		_ = os.RemoveAll(tempDir)
-		os.Exit(1)
+// Reads one URL per line, skipping blank lines and # comments
+func readURLs(r io.Reader) []string {
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
 	}
+	return urls
+}
 
-	// Move single video
-	if isSingleVideo {
-		videoFile, err := utils.FindVideoFile(tempDir)
-		if err != nil {
-			log.Warn("Warning: No video file found in %s: %v", tempDir, err)
-			_ = os.RemoveAll(tempDir)
+// Separates URLs from yt-dlp flags, leaving URLs that are flag values with their flag
+func splitURLs(args []string) (urls, flags []string) {
+	for i, arg := range args {
+		isURL := strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+		if isURL && (i == 0 || !strings.HasPrefix(args[i-1], "-")) {
+			urls = append(urls, arg)
 		} else {
-			dest := filepath.Join(originalDir, filepath.Base(videoFile))
-			if utils.FileExists(dest) {
-				log.Warn("Warning: Video already exists in destination: %s, keeping temporary files", filepath.Base(dest))
-			} else if err := utils.MoveFile(videoFile, dest); err != nil {
-				log.Warn("Warning: Failed to move %s (error: %v)", filepath.Base(videoFile), err)
-			} else {
-				log.Info("Moved: %s", filepath.Base(videoFile))
-				_ = os.RemoveAll(tempDir)
-			}
+			flags = append(flags, arg)
 		}
-	} else {
-		log.Info("Playlist download complete. Files in: %s", tempDir)
 	}
+	return urls, flags
 }
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"yaria/config"
+	"yaria/downloader"
+	"yaria/logger"
+)
+
+// Job states reported by the API
+const (
+	StatusQueued      = "queued"
+	StatusDownloading = "downloading"
+	StatusFinished    = "finished"
+	StatusFailed      = "failed"
+)
+
+// A queued or completed download
+type Job struct {
+	ID        string                   `json:"id"`
+	URL       string                   `json:"url"`
+	Format    string                   `json:"format,omitempty"`
+	AudioOnly bool                     `json:"audioOnly"`
+	Status    string                   `json:"status"`
+	Progress  downloader.ProgressEvent `json:"progress"`
+	Result    *downloader.Result       `json:"result,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+// Body of POST /download
+type downloadRequest struct {
+	URL       string `json:"url"`
+	Format    string `json:"format"`
+	AudioOnly bool   `json:"audioOnly"`
+}
+
+// HTTP API that queues downloads and reports their progress
+type Server struct {
+	cfg    *config.Config
+	dl     *downloader.YTDLPDownloader
+	log    logger.Logger
+	dir    string
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	order  []string
+	nextID int
+	queue  chan *Job
+	// SSE listeners waiting on each job's progress
+	subscribers map[string][]chan downloader.ProgressEvent
+}
+
+// Creates a server that downloads into dir
+func New(cfg *config.Config, dl *downloader.YTDLPDownloader, log logger.Logger, dir string) *Server {
+	return &Server{
+		cfg:         cfg,
+		dl:          dl,
+		log:         log,
+		dir:         dir,
+		jobs:        make(map[string]*Job),
+		queue:       make(chan *Job, 100),
+		subscribers: make(map[string][]chan downloader.ProgressEvent),
+	}
+}
+
+// Routes for the download API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /download", s.handleDownload)
+	mux.HandleFunc("GET /status/{id}", s.handleStatus)
+	mux.HandleFunc("GET /downloads", s.handleList)
+	mux.HandleFunc("GET /events/{id}", s.handleEvents)
+	return mux
+}
+
+// Starts the download worker and serves the API on addr
+func (s *Server) ListenAndServe(addr string) error {
+	go s.worker()
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	var req downloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	req.Format = strings.TrimSpace(req.Format)
+	if err := validateRequest(req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	job := &Job{
+		ID:        strconv.Itoa(s.nextID),
+		URL:       req.URL,
+		Format:    req.Format,
+		AudioOnly: req.AudioOnly,
+		Status:    StatusQueued,
+	}
+	s.jobs[job.ID] = job
+	s.order = append(s.order, job.ID)
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- job:
+	default:
+		s.update(job, func(j *Job) {
+			j.Status = StatusFailed
+			j.Error = "download queue is full"
+		})
+		writeError(w, http.StatusServiceUnavailable, "download queue is full")
+		return
+	}
+	s.log.Info("Queued download %s: %s", job.ID, job.URL)
+	writeJSON(w, http.StatusAccepted, s.snapshot(job))
+}
+
+// Checks that a request names an http(s) page and a format yt-dlp accepts, so nothing
+// from the body can be read by yt-dlp as an option
+func validateRequest(req downloadRequest) error {
+	if req.URL == "" {
+		return errors.New("url is required")
+	}
+	if strings.HasPrefix(req.URL, "-") {
+		return errors.New("url must not start with -")
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if req.Format == "" {
+		return nil
+	}
+	if req.AudioOnly {
+		if !slices.Contains(config.AudioFormats, req.Format) {
+			return fmt.Errorf("format must be one of %s for audio", strings.Join(config.AudioFormats, ", "))
+		}
+		return nil
+	}
+	if strings.HasPrefix(req.Format, "-") || strings.ContainsFunc(req.Format, unicode.IsSpace) {
+		return errors.New("format must be a height like 1080p or a yt-dlp format selector")
+	}
+	return nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	job, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown download id")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.snapshot(job))
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, *s.jobs[id])
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// Streams a job's progress as server-sent events until it completes
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	id := r.PathValue("id")
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "unknown download id")
+		return
+	}
+	current := *job
+	var events chan downloader.ProgressEvent
+	if !isDone(current.Status) {
+		events = make(chan downloader.ProgressEvent, 64)
+		s.subscribers[id] = append(s.subscribers[id], events)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Already finished jobs only get their terminal event
+	if events == nil {
+		writeEvent(w, current.Status, terminalEvent(&current))
+		flusher.Flush()
+		return
+	}
+	defer s.unsubscribe(id, events)
+
+	writeEvent(w, "progress", current.Progress)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			name := "progress"
+			if isDone(event.Status) {
+				name = event.Status
+			}
+			writeEvent(w, name, event)
+			flusher.Flush()
+			if isDone(event.Status) {
+				return
+			}
+		}
+	}
+}
+
+// Processes queued jobs one at a time
+func (s *Server) worker() {
+	for job := range s.queue {
+		s.run(job)
+	}
+}
+
+func (s *Server) run(job *Job) {
+	// Each job gets its own copy of the config so options don't leak between requests
+	jobCfg := *s.cfg
+	jobCfg.Stdout = io.Discard
+	jobCfg.IsAudioOnly = job.AudioOnly
+	if job.AudioOnly {
+		if job.Format != "" {
+			jobCfg.AudioFormat = job.Format
+		}
+	} else {
+		jobCfg.Resolution = config.ResolutionFormat(job.Format)
+	}
+
+	dl := s.dl.WithConfig(&jobCfg)
+	dl.SetProgressCallback(func(event downloader.ProgressEvent) {
+		s.update(job, func(j *Job) { j.Progress = event })
+		s.publish(job.ID, event)
+	})
+
+	s.update(job, func(j *Job) { j.Status = StatusDownloading })
+	s.log.Info("Starting download %s: %s", job.ID, job.URL)
+
+	result := downloader.NewClient(dl, s.log).Fetch(context.Background(), []string{job.URL}, s.dir)
+	s.update(job, func(j *Job) {
+		j.Result = &result
+		if result.Err != nil {
+			j.Status = StatusFailed
+			j.Error = result.Err.Error()
+		} else {
+			j.Status = StatusFinished
+			j.Progress.Percent = 100
+		}
+	})
+	s.finish(job)
+	if result.Err != nil {
+		s.log.Error("Download %s failed: %v", job.ID, result.Err)
+	} else {
+		s.log.Info("Download %s finished", job.ID)
+	}
+}
+
+// Sends a progress event to every listener of a job without blocking the download
+func (s *Server) publish(id string, event downloader.ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.subscribers[id] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Sends the terminal event for a job and closes its streams
+func (s *Server) finish(job *Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event := terminalEvent(job)
+	for _, ch := range s.subscribers[job.ID] {
+		// Make room so the terminal event is never dropped
+		select {
+		case ch <- event:
+		default:
+			<-ch
+			ch <- event
+		}
+		close(ch)
+	}
+	delete(s.subscribers, job.ID)
+}
+
+// Removes a listener that disconnected early
+func (s *Server) unsubscribe(id string, events chan downloader.ProgressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	listeners := s.subscribers[id]
+	for i, ch := range listeners {
+		if ch == events {
+			s.subscribers[id] = append(listeners[:i], listeners[i+1:]...)
+			break
+		}
+	}
+}
+
+// Applies a change to a job under the lock
+func (s *Server) update(job *Job, change func(*Job)) {
+	s.mu.Lock()
+	change(job)
+	s.mu.Unlock()
+}
+
+// Copies a job under the lock for encoding
+func (s *Server) snapshot(job *Job) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *job
+}
+
+// Builds the final event for a completed job
+func terminalEvent(job *Job) downloader.ProgressEvent {
+	event := job.Progress
+	event.Status = job.Status
+	event.Line = job.Error
+	return event
+}
+
+func isDone(status string) bool {
+	return status == StatusFinished || status == StatusFailed
+}
+
+func writeEvent(w io.Writer, name string, event downloader.ProgressEvent) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"yaria/config"
+	"yaria/logger"
+)
+
+// Returns a server whose worker isn't running, so queued jobs stay queued
+func newTestServer(t *testing.T) *Server {
+	log := logger.NewConsoleLogger()
+	log.SetOutput(io.Discard)
+	cfg, _ := config.New()
+	return New(cfg, nil, log, t.TempDir())
+}
+
+// Posts body to /download and returns the status code and decoded JSON answer
+func postDownload(t *testing.T, s *Server, body string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/download", strings.NewReader(body)))
+	var answer map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("decoding answer %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, answer
+}
+
+func TestHandleDownload(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"bad JSON", `{"url":`, http.StatusBadRequest},
+		{"missing url", `{}`, http.StatusBadRequest},
+		{"blank url", `{"url":"  "}`, http.StatusBadRequest},
+		{"option-looking url", `{"url":"--exec=touch /tmp/pwned"}`, http.StatusBadRequest},
+		{"relative url", `{"url":"watch?v=dQw4w9WgXcQ"}`, http.StatusBadRequest},
+		{"other scheme", `{"url":"file:///etc/passwd"}`, http.StatusBadRequest},
+		{"option-looking format", `{"url":"https://example.com/v","format":"--exec=id"}`, http.StatusBadRequest},
+		{"format with spaces", `{"url":"https://example.com/v","format":"best --exec id"}`, http.StatusBadRequest},
+		{"unknown audio format", `{"url":"https://example.com/v","format":"exe","audioOnly":true}`, http.StatusBadRequest},
+		{"plain url", `{"url":"https://example.com/v"}`, http.StatusAccepted},
+		{"height", `{"url":"https://example.com/v","format":"1080p"}`, http.StatusAccepted},
+		{"format selector", `{"url":"https://example.com/v","format":"bestvideo[height<=720]+bestaudio/best"}`, http.StatusAccepted},
+		{"audio format", `{"url":"http://example.com/v","format":"mp3","audioOnly":true}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			status, answer := postDownload(t, s, tt.body)
+			if status != tt.status {
+				t.Fatalf("POST /download %s = %d %v, want %d", tt.body, status, answer, tt.status)
+			}
+			if status == http.StatusBadRequest {
+				if answer["error"] == nil {
+					t.Errorf("POST /download %s answered %v, want an error", tt.body, answer)
+				}
+				if len(s.jobs) != 0 {
+					t.Errorf("POST /download %s created %d jobs, want none", tt.body, len(s.jobs))
+				}
+			} else if answer["status"] != StatusQueued {
+				t.Errorf("POST /download %s status = %v, want %s", tt.body, answer["status"], StatusQueued)
+			}
+		})
+	}
+}
+
+func TestHandleDownloadQueueFull(t *testing.T) {
+	s := newTestServer(t)
+	for range cap(s.queue) {
+		if status, answer := postDownload(t, s, `{"url":"https://example.com/v"}`); status != http.StatusAccepted {
+			t.Fatalf("filling the queue: got %d %v", status, answer)
+		}
+	}
+
+	status, answer := postDownload(t, s, `{"url":"https://example.com/v"}`)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("POST /download on a full queue = %d %v, want %d", status, answer, http.StatusServiceUnavailable)
+	}
+	id := answer["id"]
+	if id != nil {
+		t.Errorf("rejected download answered with job id %v", id)
+	}
+	last := s.jobs[s.order[len(s.order)-1]]
+	if last.Status != StatusFailed || last.Error == "" {
+		t.Errorf("rejected job = %s %q, want %s with an error", last.Status, last.Error, StatusFailed)
+	}
+}
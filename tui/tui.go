@@ -1,24 +1,28 @@
 package tui
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"yaria/config"
 	"yaria/downloader"
 	"yaria/logger"
+	"yaria/utils"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -31,8 +35,13 @@ const (
 	urlState state = iota
 	metadataLoadingState
 	browserSelectionState
+	playlistSelectState
 	formatState
 	resolutionState
+	fragmentsState
+	audioFormatState
+	audioOnlyPromptState
+	premierePromptState
 	downloadLocationState
 	confirmationState
 	formatsLoadingState
@@ -67,32 +76,22 @@ type Model struct {
 	availableBrowsers []string
 	needsBrowser      bool
 	downloadProgress  string
-	downloadPercent   float64
-	downloadSpeed     string
-	downloadETA       string
+	downloadEvent     downloader.ProgressEvent
 	downloadComplete  bool
 	downloadError     string
+	DownloadErr       error              // Why the download failed or was cancelled, nil on success
+	cancelDownload    context.CancelFunc // Kills the running yt-dlp when the TUI quits mid-download
+	skipItem          chan struct{}      // Asks runDownload to skip the playlist item being downloaded
+	skippedItems      int                // Playlist items skipped during the download
+	destPath          string             // Predicted output file shown on the confirmation screen
+	destExists        bool               // Whether destPath is already taken
 	TempDir           string
 	Args              []string
-}
-
-// Splits on either '\r' or '\n' so we capture carriage-return progress updates
-func splitCRLF(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
-		// handle CRLF (\r\n)
-		if data[i] == '\r' {
-			if i+1 < len(data) && data[i+1] == '\n' {
-				return i + 2, data[:i], nil
-			}
-			return i + 1, data[:i], nil
-		}
-		// LF
-		return i + 1, data[:i], nil
-	}
-	if atEOF && len(data) > 0 {
-		return len(data), data, nil
-	}
-	return 0, nil, nil
+	playlistEntries   []downloader.PlaylistEntry
+	playlistSelected  []bool
+	playlistItems     string // --playlist-items value built from the selection, empty for all
+	waitingPremiere   bool   // Metadata is unavailable until the premiere starts
+	hasFFmpeg         bool   // Whether audio postprocessing options can be offered
 }
 
 func New(cfg *config.Config, log logger.Logger) *Model {
@@ -125,7 +124,27 @@ func (m *Model) SetDownloader(dl downloader.Downloader) {
 	m.dl = dl
 }
 
+// Returned by CheckTTY and Run when there is no terminal to draw the TUI on
+var ErrNoTTY = errors.New("no terminal available")
+
+// Checks that the terminal the TUI reads input from can be opened
+func CheckTTY() error {
+	path := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		path = "CONIN$"
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoTTY, err)
+	}
+	f.Close()
+	return nil
+}
+
 func (m *Model) Run(url, title string) error {
+	if err := CheckTTY(); err != nil {
+		return err
+	}
 	m.url = url
 	m.Title = title
 	if url != "" {
@@ -137,6 +156,9 @@ func (m *Model) Run(url, title string) error {
 }
 
 func (m *Model) RunDownloadOnly() error {
+	if err := CheckTTY(); err != nil {
+		return err
+	}
 	// Start directly in downloading state
 	m.state = downloadingState
 	p := tea.NewProgram(m, tea.WithInputTTY())
@@ -164,6 +186,7 @@ type metadataFetchedMsg struct {
 	playlistInfo  string
 	title         string
 	thumbnailPath string
+	entries       []downloader.PlaylistEntry
 	err           error
 }
 
@@ -178,14 +201,13 @@ type browsersDetectedMsg struct {
 
 type downloadProgressMsg struct {
 	progress string
-	percent  float64
-	speed    string
-	eta      string
+	event    downloader.ProgressEvent
 }
 
 type downloadCompleteMsg struct {
 	success bool
 	err     error
+	skipped int
 }
 
 type rainbowAnimMsg struct{}
@@ -194,6 +216,11 @@ type yaziLocationSelectedMsg struct {
 	path string
 }
 
+type destinationPredictedMsg struct {
+	path string
+	err  error
+}
+
 // Collection of funny quotes inspired by Minecraft splash texts
 var quotes = []string{
 	"More pixels than reality!",
@@ -376,10 +403,20 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateMetadataLoading(msg)
 	case browserSelectionState:
 		return m.updateBrowserSelection(msg)
+	case playlistSelectState:
+		return m.updatePlaylistSelect(msg)
 	case formatState:
 		return m.updateFormat(msg)
 	case resolutionState:
 		return m.updateResolution(msg)
+	case fragmentsState:
+		return m.updateFragments(msg)
+	case audioFormatState:
+		return m.updateAudioFormat(msg)
+	case audioOnlyPromptState:
+		return m.updateAudioOnlyPrompt(msg)
+	case premierePromptState:
+		return m.updatePremierePrompt(msg)
 	case downloadLocationState:
 		return m.updateDownloadLocation(msg)
 	case confirmationState:
@@ -427,9 +464,23 @@ func (m *Model) updateURL(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// Implemented by downloaders that can list formats in the background
+type formatPrefetcher interface {
+	PrefetchFormats(ctx context.Context, urls []string, workers int)
+}
+
 func (m *Model) fetchMetadata() tea.Cmd {
 	return func() tea.Msg {
-		playlistInfo, title, err := m.dl.GetMetadata([]string{m.url})
+		if m.cfg.PreflightCheck {
+			if err := downloader.Preflight(m.cfg, m.url); err != nil {
+				return metadataFetchedMsg{err: err}
+			}
+		}
+		// List formats alongside the metadata so the resolution menu is ready sooner
+		if prefetcher, ok := m.dl.(formatPrefetcher); ok {
+			prefetcher.PrefetchFormats(context.Background(), []string{m.url}, m.cfg.FormatProbeConcurrency)
+		}
+		playlistInfo, title, err := m.dl.GetMetadata(context.Background(), []string{m.url})
 
 		// Thumbnail extraction disabled for now
 		// var thumbnailPath string
@@ -439,15 +490,28 @@ func (m *Model) fetchMetadata() tea.Cmd {
 		// 	thumbnailPath, _ = m.dl.GetThumbnail([]string{m.url}, tempDir)
 		// }
 
+		// Playlist items are listed up front so they can be picked individually
+		var entries []downloader.PlaylistEntry
+		if err == nil && isPlaylistInfo(playlistInfo) {
+			entries, _ = m.dl.GetPlaylistEntries(context.Background(), m.url)
+		}
+
 		return metadataFetchedMsg{
 			playlistInfo:  playlistInfo,
 			title:         title,
 			thumbnailPath: "", // thumbnailPath,
+			entries:       entries,
 			err:           err,
 		}
 	}
 }
 
+// Reports whether "playlist&title&count" metadata describes a multi-item playlist
+func isPlaylistInfo(playlistInfo string) bool {
+	parts := utils.SplitN(playlistInfo, "&", 3)
+	return len(parts) == 3 && parts[0] != "NA" && utils.MustParseInt(parts[2]) > 1
+}
+
 // Checks which supported browsers are available
 func detectBrowsers() []string {
 	var browsers []string
@@ -490,14 +554,22 @@ func (m *Model) updateMetadataLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.errorMsg = fmt.Sprintf("Failed to fetch metadata: %v", msg.err)
 				return m, tea.Quit
 			}
+			if errors.Is(msg.err, downloader.ErrUpcomingVideo) {
+				m.state = premierePromptState
+				return m, nil
+			}
 			m.errorMsg = fmt.Sprintf("Failed to fetch metadata: %v", msg.err)
 			return m, tea.Quit
 		}
 		m.PlaylistInfo = msg.playlistInfo
 		m.Title = msg.title
+		m.cfg.IsPlaylist = isPlaylistInfo(msg.playlistInfo)
 		m.ThumbnailPath = msg.thumbnailPath
-		m.state = formatState
-		m.cursor = 0
+		if len(msg.entries) > 1 {
+			m.enterPlaylistSelect(msg.entries)
+			return m, nil
+		}
+		m.enterFormat()
 		return m, nil
 	case browsersDetectedMsg:
 		m.availableBrowsers = msg.browsers
@@ -556,6 +628,86 @@ func (m *Model) updateBrowserSelection(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func (m *Model) enterPlaylistSelect(entries []downloader.PlaylistEntry) {
+	m.state = playlistSelectState
+	m.cursor = 0
+	m.playlistEntries = entries
+	m.playlistSelected = make([]bool, len(entries))
+	for i, entry := range entries {
+		// Preselect the items given with -items, or everything
+		m.playlistSelected[i] = downloader.PlaylistItemSelected(m.cfg.PlaylistItems, entry.Index)
+	}
+}
+
+func (m *Model) updatePlaylistSelect(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.playlistEntries)-1 {
+				m.cursor++
+			}
+		case " ":
+			m.playlistSelected[m.cursor] = !m.playlistSelected[m.cursor]
+		case "a":
+			// Select all, or clear everything when all are already selected
+			all := true
+			for _, selected := range m.playlistSelected {
+				all = all && selected
+			}
+			for i := range m.playlistSelected {
+				m.playlistSelected[i] = !all
+			}
+		case "enter":
+			items, count := playlistItemsArg(m.playlistEntries, m.playlistSelected)
+			if count == 0 {
+				return m, nil
+			}
+			m.playlistItems = items
+			m.enterFormat()
+		}
+	}
+	return m, nil
+}
+
+// Builds a --playlist-items value from the selection, empty when everything is selected
+func playlistItemsArg(entries []downloader.PlaylistEntry, selected []bool) (string, int) {
+	var indexes []string
+	for i, entry := range entries {
+		if selected[i] {
+			indexes = append(indexes, strconv.Itoa(entry.Index))
+		}
+	}
+	if len(indexes) == len(entries) {
+		return "", len(indexes)
+	}
+	return strings.Join(indexes, ","), len(indexes)
+}
+
+// Formats seconds as [h:]mm:ss
+func formatDuration(seconds float64) string {
+	s := int(seconds)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+func (m *Model) enterFormat() {
+	m.state = formatState
+	m.cursor = 0
+	m.choices = []string{
+		"Video (with audio)",
+		"Audio only",
+	}
+}
+
 func (m *Model) updateFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -570,8 +722,14 @@ func (m *Model) updateFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.cursor < len(m.choices)-1 {
 				m.cursor++
 			}
+		case "s":
+			m.cfg.WriteSubs = !m.cfg.WriteSubs
 		case "enter":
-			if m.cursor == 0 {
+			if m.cursor == 0 && m.waitingPremiere {
+				m.cfg.IsAudioOnly = false
+				m.cfg.Resolution = ""
+				m.enterDownloadLocation()
+			} else if m.cursor == 0 {
 				m.cfg.IsAudioOnly = false
 				m.state = formatsLoadingState
 				m.loadingStart = time.Now()
@@ -583,9 +741,9 @@ func (m *Model) updateFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}),
 				)
 			} else {
+				// Through the audio format screen, which also offers the loudness normalization toggle
 				m.cfg.IsAudioOnly = true
-				m.state = confirmationState
-				m.cursor = 0
+				m.enterAudioFormat()
 			}
 		}
 	}
@@ -594,7 +752,7 @@ func (m *Model) updateFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *Model) fetchFormats() tea.Cmd {
 	return func() tea.Msg {
-		formats, err := m.dl.GetFormats(m.url)
+		formats, err := m.dl.GetFormats(context.Background(), m.url)
 		return formatsFetchedMsg{formats: formats, err: err}
 	}
 }
@@ -613,18 +771,23 @@ func (m *Model) updateFormatsLoading(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.videoFormats = append(m.videoFormats, f)
 			}
 		}
-		if len(m.videoFormats) == 0 {
+		if len(m.videoFormats) == 0 && len(msg.formats) > 0 {
+			// Only audio streams exist, don't quietly turn a video request into an audio file
 			m.cfg.Resolution = ""
-			m.state = confirmationState
-			m.cursor = 0
+			if m.cfg.AudioFallback {
+				m.cfg.IsAudioOnly = true
+				m.enterAudioFormat()
+			} else {
+				m.state = audioOnlyPromptState
+				m.cursor = 0
+			}
+		} else if len(m.videoFormats) == 0 {
+			m.cfg.Resolution = ""
+			return m, m.enterConfirmation()
 		} else {
 			m.choices = []string{"Default (best available)"}
 			for _, f := range m.videoFormats {
-				if f.FileSize != "" {
-					m.choices = append(m.choices, fmt.Sprintf("%dp (%s, %s) - %s", f.Height, f.Ext, f.Protocol, f.FileSize))
-				} else {
-					m.choices = append(m.choices, fmt.Sprintf("%dp (%s, %s)", f.Height, f.Ext, f.Protocol))
-				}
+				m.choices = append(m.choices, resolutionChoice(f))
 			}
 			m.state = resolutionState
 			m.cursor = 0
@@ -658,26 +821,252 @@ func (m *Model) updateResolution(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.cursor < len(m.choices)-1 {
 				m.cursor++
 			}
+		case "a":
+			// Changed mind: switch to audio only without refetching anything
+			m.cfg.IsAudioOnly = true
+			m.cfg.Resolution = ""
+			m.enterAudioFormat()
 		case "enter":
 			if m.cursor == 0 {
 				m.cfg.Resolution = ""
 			} else if m.cursor-1 < len(m.videoFormats) {
 				m.cfg.Resolution = m.videoFormats[m.cursor-1].ID
+				// Fragmented formats get a chance to tune fragment concurrency
+				if isFragmentedProtocol(m.videoFormats[m.cursor-1].Protocol) {
+					m.enterFragments()
+					return m, nil
+				}
 			} else {
 				m.cfg.Resolution = ""
 			}
-			m.state = downloadLocationState
-			m.cursor = 0
-			// Initialize download location choices
-			m.locationChoices = []string{
-				"📁 Choose Download Location (Browse with Yazi)",
-				"📁 Download in Current Directory",
+			m.enterDownloadLocation()
+		}
+	}
+	return m, nil
+}
+
+// Colors of the format table: resolution by media kind, protocol by delivery
+var (
+	videoFormatColor  = lipgloss.Color("39")
+	audioFormatColor  = lipgloss.Color("170")
+	directFormatColor = lipgloss.Color("42")
+	streamFormatColor = lipgloss.Color("214")
+)
+
+// Renders formats as aligned, color-coded rows with column widths fitted to the data,
+// returning the header row and one row per format
+func formatTable(formats []downloader.Format) (string, []string) {
+	header := []string{"RES", "FPS", "CODEC", "EXT", "SIZE", "PROTO"}
+	widths := make([]int, len(header))
+	for j, title := range header {
+		widths[j] = lipgloss.Width(title)
+	}
+	cells := make([][]string, len(formats))
+	for i, f := range formats {
+		res := "audio"
+		if !f.IsAudio {
+			res = fmt.Sprintf("%dp", f.Height)
+		}
+		fps := ""
+		if f.FPS > 0 {
+			fps = strconv.Itoa(f.FPS)
+		}
+		cells[i] = []string{res, fps, f.Codec, f.Ext, f.FileSize, f.Protocol}
+		for j, cell := range cells[i] {
+			widths[j] = max(widths[j], lipgloss.Width(cell))
+		}
+	}
+
+	renderRow := func(row []string, styles []lipgloss.Style) string {
+		var b strings.Builder
+		for j, cell := range row {
+			b.WriteString(styles[j].Width(widths[j] + 2).Render(cell))
+		}
+		return strings.TrimRight(b.String(), " ")
+	}
+	headerStyles := make([]lipgloss.Style, len(header))
+	for j := range headerStyles {
+		headerStyles[j] = lipgloss.NewStyle().Faint(true)
+	}
+
+	rows := make([]string, len(formats))
+	for i, f := range formats {
+		styles := make([]lipgloss.Style, len(header))
+		for j := range styles {
+			styles[j] = lipgloss.NewStyle()
+		}
+		if f.IsAudio {
+			styles[0] = styles[0].Foreground(audioFormatColor)
+		} else {
+			styles[0] = styles[0].Foreground(videoFormatColor).Bold(true)
+		}
+		if isFragmentedProtocol(f.Protocol) {
+			styles[5] = styles[5].Foreground(streamFormatColor)
+		} else {
+			styles[5] = styles[5].Foreground(directFormatColor)
+		}
+		rows[i] = renderRow(cells[i], styles)
+	}
+	return renderRow(header, headerStyles), rows
+}
+
+// Labels a format in the resolution menu, e.g. "1080p (mp4, 245.3 MiB, 2.6 Mbps)".
+// Sizes yt-dlp only estimates start with "~", unknown ones are a bare "~".
+func resolutionChoice(f downloader.Format) string {
+	size := "~"
+	if f.SizeBytes > 0 {
+		size = utils.HumanBytes(f.SizeBytes)
+		if f.SizeApprox {
+			size = "~" + size
+		}
+	}
+	if f.TBR > 0 {
+		return fmt.Sprintf("%dp (%s, %s, %.1f Mbps)", f.Height, f.Ext, size, f.TBR/1000)
+	}
+	return fmt.Sprintf("%dp (%s, %s)", f.Height, f.Ext, size)
+}
+
+// Reports whether a format is downloaded in fragments (HLS or DASH)
+func isFragmentedProtocol(protocol string) bool {
+	return strings.Contains(protocol, "m3u8") || strings.Contains(protocol, "dash")
+}
+
+// Fragment counts offered for HLS/DASH formats
+var fragmentCounts = []int{1, 4, 8, 16, 32, 64}
+
+func (m *Model) enterFragments() {
+	m.state = fragmentsState
+	current := m.cfg.FragmentCount(32, 0)
+	m.choices = []string{}
+	m.cursor = 0
+	for i, n := range fragmentCounts {
+		label := fmt.Sprintf("%d fragments", n)
+		if n == current {
+			label += " (default)"
+			m.cursor = i
+		}
+		m.choices = append(m.choices, label)
+	}
+}
+
+func (m *Model) updateFragments(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.choices)-1 {
+				m.cursor++
+			}
+		case "enter":
+			m.cfg.ConcurrentFragments = strconv.Itoa(fragmentCounts[m.cursor])
+			m.enterDownloadLocation()
+		}
+	}
+	return m, nil
+}
+
+// Audio formats yt-dlp can extract to
+var audioFormats = []string{"mp3", "m4a", "opus", "flac", "wav"}
+
+func (m *Model) enterAudioFormat() {
+	m.state = audioFormatState
+	m.hasFFmpeg = downloader.HasFFmpeg()
+	m.choices = []string{}
+	m.cursor = 0
+	for i, f := range audioFormats {
+		label := f
+		if f == m.cfg.AudioFormat {
+			label += " (default)"
+			m.cursor = i
+		}
+		m.choices = append(m.choices, label)
+	}
+}
+
+func (m *Model) updateAudioFormat(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.choices)-1 {
+				m.cursor++
+			}
+		case "n":
+			if m.hasFFmpeg {
+				m.cfg.AudioNormalize = !m.cfg.AudioNormalize
+			}
+		case "enter":
+			m.cfg.AudioFormat = audioFormats[m.cursor]
+			m.enterDownloadLocation()
+		}
+	}
+	return m, nil
+}
+
+func (m *Model) updateAudioOnlyPrompt(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "y":
+			m.cfg.IsAudioOnly = true
+			m.enterAudioFormat()
+		case "n":
+			m.errorMsg = "No video formats available, only audio"
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// Poll interval used when waiting for a premiere without --wait-for-video
+const defaultPremiereWait = "60"
+
+func (m *Model) updatePremierePrompt(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "y":
+			// Nothing can be listed before it starts, so download the best format once it's live
+			if m.cfg.WaitForVideo == "" {
+				m.cfg.WaitForVideo = defaultPremiereWait
 			}
+			m.waitingPremiere = true
+			m.PlaylistInfo = "NA&NA&1"
+			m.enterFormat()
+		case "n":
+			m.errorMsg = downloader.ErrUpcomingVideo.Error()
+			return m, tea.Quit
 		}
 	}
 	return m, nil
 }
 
+func (m *Model) enterDownloadLocation() {
+	m.state = downloadLocationState
+	m.cursor = 0
+	// Initialize download location choices
+	m.locationChoices = []string{
+		"📁 Choose Download Location (Browse with Yazi)",
+		"📁 Download in Current Directory",
+	}
+}
+
 func (m *Model) updateDownloadLocation(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -699,32 +1088,81 @@ func (m *Model) updateDownloadLocation(msg tea.Msg) (tea.Model, tea.Cmd) {
 			} else {
 				// Use current directory - create temp dir if not set
 				if m.TempDir == "" {
-					// Generate temp directory name from title
-					finalName := m.Title
+					// Generate temp directory name from title, trimmed like the yt-dlp output name
+					finalName := utils.TrimFilename(utils.SanitizeFilename(m.Title), m.cfg.TrimFilenames)
 					if finalName == "" {
 						finalName = "Video_" + fmt.Sprintf("%d", time.Now().Unix())
 					}
 					// Create temp directory in current directory
 					cwd, _ := os.Getwd()
 					m.TempDir = filepath.Join(cwd, finalName)
+					if m.cfg.DirectDownload && !m.cfg.IsPlaylist {
+						m.TempDir = cwd
+					}
 					os.MkdirAll(m.TempDir, 0o755)
 				}
 				m.cfg.DownloadLocation = ""
-				m.state = confirmationState
-				m.cursor = 0
+				return m, m.enterConfirmation()
 			}
 		}
 	case yaziLocationSelectedMsg:
 		// User selected a location with yazi
 		m.cfg.DownloadLocation = msg.path
-		m.state = confirmationState
-		m.cursor = 0
+		return m, m.enterConfirmation()
 	}
 	return m, nil
 }
 
+// Shows the confirmation screen and starts predicting where the download will land
+func (m *Model) enterConfirmation() tea.Cmd {
+	m.state = confirmationState
+	m.cursor = 0
+	m.destPath = ""
+	m.destExists = false
+	url, outputPath, tempDir := m.url, m.outputPath(), m.TempDir
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		args := []string{url, "--playlist-items", "1", "--output", outputPath}
+		path, err := m.dl.GetOutputFilename(ctx, args, tempDir)
+		if err != nil {
+			return destinationPredictedMsg{err: err}
+		}
+		if !filepath.IsAbs(path) {
+			cwd, _ := os.Getwd()
+			path = filepath.Join(cwd, path)
+		}
+		// Extracted audio is renamed to the target format after the download
+		if m.cfg.IsAudioOnly && m.cfg.AudioFormat != "" && m.cfg.AudioFormat != "best" {
+			path = strings.TrimSuffix(path, filepath.Ext(path)) + "." + m.cfg.AudioFormat
+		}
+		return destinationPredictedMsg{path: path}
+	}
+}
+
+// Returns the yt-dlp output template the download will use
+func (m *Model) outputPath() string {
+	template := utils.ExpandHome(m.cfg.ActiveOutputTemplate())
+	if filepath.IsAbs(template) {
+		// Absolute templates already say where the file goes
+		return template
+	} else if m.cfg.DownloadLocation != "" {
+		// Custom location: create subdirectory with video name
+		return m.cfg.DownloadLocation + "/%(title)s/%(title)s.%(ext)s"
+	}
+	// Current directory: use TempDir
+	return m.TempDir + "/" + template
+}
+
 func (m *Model) updateConfirmation(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case destinationPredictedMsg:
+		if msg.err != nil {
+			m.destPath = "unknown (" + msg.err.Error() + ")"
+			return m, nil
+		}
+		m.destPath = msg.path
+		m.destExists = utils.FileExists(msg.path)
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "ctrl+c":
@@ -755,26 +1193,26 @@ func (m *Model) updateConfirmation(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 func (m *Model) startDownload() tea.Cmd {
 	// Start the actual download in a goroutine
-	go m.runDownload()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelDownload = cancel
+	m.skipItem = make(chan struct{}, 1)
+	go m.runDownload(ctx)
 	// Return a command that waits for progress updates
 	return waitForProgress
 }
 
-func (m *Model) runDownload() {
+func (m *Model) runDownload(ctx context.Context) {
 	// Send initial progress message
-	m.sendProgress("Starting download...", 0, "", "")
+	m.sendProgress("Starting download...", downloader.ProgressEvent{})
 
 	// Build yt-dlp command
-	ytDlpCmd := "yt-dlp"
-	if runtime.GOOS == "windows" {
-		ytDlpCmd = "yt-dlp.exe"
-	}
+	ytDlpCmd := downloader.YTDLPCommand(m.cfg)
 
 	cmdArgs := []string{
 		"--no-overwrites",
 		"--geo-bypass",
 		"--no-check-certificate",
-		"--concurrent-fragments", "32",
+		"--concurrent-fragments", strconv.Itoa(m.cfg.FragmentCount(32, 0)),
 		"--buffer-size", "64K",
 		"--http-chunk-size", "10M",
 		"--newline",
@@ -782,7 +1220,6 @@ func (m *Model) runDownload() {
 		"--no-color",
 		"--extractor-retries", "2",
 		"--fragment-retries", "3",
-		"--progress-template", "%(progress)s %(progress._total_bytes_str)s %(progress._downloaded_bytes_str)s %(progress._speed_str)s %(progress._eta_str)s",
 	}
 
 	// Check if this is a problematic site that needs special handling
@@ -808,7 +1245,7 @@ func (m *Model) runDownload() {
 			"--no-overwrites",
 			"--geo-bypass",
 			"--no-check-certificate",
-			"--concurrent-fragments", "8", // Reduced from 32
+			"--concurrent-fragments", strconv.Itoa(m.cfg.FragmentCount(8, 0)), // Reduced from 32
 			"--buffer-size", "32K", // Reduced from 64K
 			"--http-chunk-size", "5M", // Reduced from 10M
 			"--newline",
@@ -818,23 +1255,10 @@ func (m *Model) runDownload() {
 			"--fragment-retries", "10", // Increased from 3
 			"--retries", "10", // Added general retries
 			"--retry-sleep", "5", // Added sleep between retries
-			"--progress-template", "%(progress)s %(progress._total_bytes_str)s %(progress._downloaded_bytes_str)s %(progress._speed_str)s %(progress._eta_str)s",
 		}
 	}
 
-	var outputPath string
-	if m.cfg.DownloadLocation != "" {
-		// Custom location: create subdirectory with video name
-		outputPath = m.cfg.DownloadLocation + "/%(title)s/%(title)s.%(ext)s"
-	} else {
-		// Current directory: use TempDir
-		outputPath = m.TempDir + "/" + m.cfg.OutputTemplate
-	}
-	cmdArgs = append(cmdArgs, "--output", outputPath)
-
-	if m.cfg.CookieBrowser != "" {
-		cmdArgs = append(cmdArgs, "--cookies-from-browser", m.cfg.CookieBrowser)
-	}
+	cmdArgs = append(cmdArgs, "--output", m.outputPath())
 
 	// Add user-agent to avoid bot detection
 	cmdArgs = append(cmdArgs, "--user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
@@ -900,26 +1324,93 @@ func (m *Model) runDownload() {
 	if m.cfg.IsAudioOnly {
 		cmdArgs = append(cmdArgs, "--extract-audio", "--audio-format", m.cfg.AudioFormat)
 	} else {
-		// Force mp4 container for video downloads
-		cmdArgs = append(cmdArgs, "--merge-output-format", "mp4", "--remux-video", "mp4")
+		// Force mp4 container for video downloads, unless MergeArgs picks the configured one
+		if m.cfg.MergeOutputFormat == "" {
+			cmdArgs = append(cmdArgs, "--merge-output-format", "mp4", "--remux-video", "mp4")
+		}
 		if m.cfg.Resolution != "" {
 			cmdArgs = append(cmdArgs, "--format", m.cfg.Resolution+"+bestaudio/best")
 		} else {
-			cmdArgs = append(cmdArgs, "--format", "bestvideo+bestaudio/best")
+			cmdArgs = append(cmdArgs, "--format", m.cfg.DefaultFormat)
 		}
 	}
 
 	cmdArgs = append(cmdArgs, m.Args...)
-
-	if m.cfg.UseAria2c {
-		aria2Cmd := "aria2c"
-		if runtime.GOOS == "windows" {
-			aria2Cmd = "aria2c.exe"
+	cmdArgs = append(cmdArgs, downloader.DefaultSubtitleArgs(m.cfg, m.Args)...)
+	cmdArgs = append(cmdArgs, downloader.SubtitleArgs(m.cfg)...)
+	cmdArgs = append(cmdArgs, downloader.AlbumArgs(m.cfg, "", 0)...)
+	cmdArgs = append(cmdArgs, downloader.SleepArgs(m.cfg)...)
+	cmdArgs = append(cmdArgs, downloader.CommonDownloadArgs(m.cfg, m.url, 0)...)
+
+	// Playlist indexes left to download, empty for the whole playlist until an item is skipped.
+	// Skipping restarts yt-dlp on the indexes after the skipped one.
+	items := strings.FieldsFunc(m.playlistItems, func(r rune) bool { return r == ',' })
+	skipped := 0
+	for {
+		runArgs := cmdArgs
+		if len(items) > 0 {
+			runArgs = append(slices.Clip(cmdArgs), "--playlist-items", strings.Join(items, ","))
+		}
+		result := m.runProcess(ctx, ytDlpCmd, runArgs)
+		switch {
+		case ctx.Err() != nil:
+			m.sendDownloadComplete(false, ctx.Err(), skipped)
+			return
+		case result.skipped:
+			if result.itemCount == 0 {
+				m.sendDownloadComplete(false, errors.New("download skipped"), skipped)
+				return
+			}
+			if len(items) == 0 {
+				for i := 1; i <= result.itemCount; i++ {
+					items = append(items, strconv.Itoa(i))
+				}
+			}
+			skipped++
+			items = items[min(max(result.item, 1), len(items)):]
+			if len(items) == 0 {
+				m.sendDownloadComplete(true, nil, skipped)
+				return
+			}
+			m.sendProgress(fmt.Sprintf("Skipped item %d, moving on...", result.item), downloader.ProgressEvent{})
+		case result.err != nil && downloader.IsDRMError(result.stderr):
+			m.sendDownloadComplete(false, downloader.ErrDRMProtected, skipped)
+			return
+		case result.err != nil && downloader.CookieError(m.cfg, result.stderr) != nil:
+			m.sendDownloadComplete(false, downloader.CookieError(m.cfg, result.stderr), skipped)
+			return
+		case result.err != nil:
+			m.sendDownloadComplete(false, result.err, skipped)
+			return
+		default:
+			m.sendDownloadComplete(true, nil, skipped)
+			return
 		}
-		cmdArgs = append(cmdArgs, "--downloader", aria2Cmd, "--downloader-args", "aria2c:"+m.cfg.Aria2cArgs)
 	}
+}
 
-	cmd := exec.Command(ytDlpCmd, cmdArgs...)
+// Outcome of one yt-dlp process started by runDownload
+type processResult struct {
+	err       error
+	stderr    string
+	skipped   bool // The user skipped the item being downloaded
+	item      int  // Position of the last item started among the process's playlist items
+	itemCount int
+}
+
+// Runs yt-dlp once, forwarding its progress. A skip request kills just this process.
+func (m *Model) runProcess(ctx context.Context, ytDlpCmd string, cmdArgs []string) processResult {
+	var result processResult
+	// A skip pressed between processes belonged to the previous item
+	select {
+	case <-m.skipItem:
+	default:
+	}
+	procCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Raw mode turns Ctrl+C into a key press, so yt-dlp is killed through ctx rather than SIGINT
+	cmd := exec.CommandContext(procCtx, ytDlpCmd, cmdArgs...)
 
 	// Force unbuffered output
 	cmd.Env = append(os.Environ(), "PYTHONUNBUFFERED=1")
@@ -927,160 +1418,88 @@ func (m *Model) runDownload() {
 	// Create pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		m.sendDownloadComplete(false, err)
-		return
+		result.err = err
+		return result
 	}
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		m.sendDownloadComplete(false, err)
-		return
+		result.err = err
+		return result
 	}
 
 	if err := cmd.Start(); err != nil {
-		m.sendDownloadComplete(false, err)
-		return
+		result.err = err
+		return result
 	}
 
-	// Parse output in goroutines (both stdout and stderr)
-	go m.parseOutput(stdout)
-	go m.parseOutput(stderr)
-
-	// Wait for command to complete
-	err = cmd.Wait()
-	if err != nil {
-		m.sendDownloadComplete(false, err)
-	} else {
-		m.sendDownloadComplete(true, nil)
-	}
-}
-
-func (m *Model) parseOutput(reader io.Reader) {
-	scanner := bufio.NewScanner(reader)
-	// Increase buffer size for long lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-	// Split on CR or LF so carriage-return updates are captured in real-time
-	scanner.Split(splitCRLF)
-
-	// Match our custom progress template: download:[download] 123456/987654 (12.5%) at 1.2MiB/s ETA 01:23
-	customProgressRegex := regexp.MustCompile(`download:\[download\].*?\((\d+\.?\d*)%\)`)
-	// Match yt-dlp progress: [download]  45.2% of 123.45MiB at 1.23MiB/s ETA 01:23
-	ytdlpProgressRegex := regexp.MustCompile(`\[download\]\s+(\d+\.?\d*)%`)
-	// Match aria2c progress: [#abc123 45.2MiB/123.45MiB(36%) CN:16 DL:1.2MiB ETA:1m23s]
-	aria2cProgressRegex := regexp.MustCompile(`\((\d+)%\)`)
-	// Match speed and ETA
-	speedRegex := regexp.MustCompile(`(?:DL:|at\s+)(\d+\.?\d*\w+/?s)`)
-	etaRegex := regexp.MustCompile(`ETA[:\s]+(\S+)`)
-	// Match aria2c bytes progress: e.g., 1.0MiB/89MiB
-	bytesProgressRegex := regexp.MustCompile(`([0-9.]+)\s*([kKmMgGtT]?i?B)/([0-9.]+)\s*([kKmMgGtT]?i?B)`)
-
-	// helper to convert sizes to bytes for percentage calc
-	unitToMultiplier := func(unit string) float64 {
-		switch strings.ToUpper(unit) {
-		case "B":
-			return 1
-		case "KB":
-			return 1e3
-		case "KIB":
-			return 1024
-		case "MB":
-			return 1e6
-		case "MIB":
-			return 1024 * 1024
-		case "GB":
-			return 1e9
-		case "GIB":
-			return 1024 * 1024 * 1024
-		case "TB":
-			return 1e12
-		case "TIB":
-			return 1024 * 1024 * 1024 * 1024
-		}
-		return 1
-	}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Process non-empty lines
-		if line != "" {
-			// Try standard yt-dlp progress format first: [download]  45.2% of 123.45MiB at 1.23MiB/s ETA 01:23
-			if matches := ytdlpProgressRegex.FindStringSubmatch(line); len(matches) >= 2 {
-				percent, _ := strconv.ParseFloat(matches[1], 64)
-				speed := ""
-				eta := ""
-				if speedMatches := speedRegex.FindStringSubmatch(line); len(speedMatches) >= 2 {
-					speed = speedMatches[1]
-				}
-				if etaMatches := etaRegex.FindStringSubmatch(line); len(etaMatches) >= 2 {
-					eta = etaMatches[1]
-				}
-				m.sendProgress(line, percent, speed, eta)
-			} else if matches := customProgressRegex.FindStringSubmatch(line); len(matches) >= 2 {
-				percent, _ := strconv.ParseFloat(matches[1], 64)
-				speed := ""
-				eta := ""
-				if speedMatches := speedRegex.FindStringSubmatch(line); len(speedMatches) >= 2 {
-					speed = speedMatches[1]
-				}
-				if etaMatches := etaRegex.FindStringSubmatch(line); len(etaMatches) >= 2 {
-					eta = etaMatches[1]
-				}
-				m.sendProgress(line, percent, speed, eta)
-			} else if matches := aria2cProgressRegex.FindStringSubmatch(line); len(matches) >= 2 {
-				// Parse aria2c progress format
-				percent, _ := strconv.ParseFloat(matches[1], 64)
-				speed := ""
-				eta := ""
-				if speedMatches := speedRegex.FindStringSubmatch(line); len(speedMatches) >= 2 {
-					speed = speedMatches[1]
-				}
-				if etaMatches := etaRegex.FindStringSubmatch(line); len(etaMatches) >= 2 {
-					eta = etaMatches[1]
-				}
-				m.sendProgress(line, percent, speed, eta)
-			} else if bm := bytesProgressRegex.FindStringSubmatch(line); len(bm) == 5 {
-				// Compute percent from bytes fraction when percent not present
-				cur, _ := strconv.ParseFloat(bm[1], 64)
-				tot, _ := strconv.ParseFloat(bm[3], 64)
-				mu := unitToMultiplier(bm[2])
-				mt := unitToMultiplier(bm[4])
-				if mt > 0 && tot > 0 {
-					percent := (cur * mu) / (tot * mt) * 100.0
-					speed := ""
-					if speedMatches := speedRegex.FindStringSubmatch(line); len(speedMatches) >= 2 {
-						speed = speedMatches[1]
-					}
-					eta := ""
-					if etaMatches := etaRegex.FindStringSubmatch(line); len(etaMatches) >= 2 {
-						eta = etaMatches[1]
-					}
-					m.sendProgress(line, percent, speed, eta)
+	var skipped atomic.Bool
+	go func() {
+		select {
+		case <-m.skipItem:
+			skipped.Store(true)
+			cancel()
+		case <-procCtx.Done():
+		}
+	}()
+
+	// Forward progress from both pipes, aria2c reports on either depending on the yt-dlp version.
+	// stderr is kept to look for DRM errors once the download ends.
+	var errOutput bytes.Buffer
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, io.TeeReader(stderr, &errOutput)} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range downloader.StreamProgress(r) {
+				if event.ItemCount > 0 {
+					mu.Lock()
+					result.item, result.itemCount = event.ItemIndex, event.ItemCount
+					mu.Unlock()
 				}
-			} else if strings.Contains(line, "[download]") || strings.Contains(line, "[info]") || strings.Contains(line, "Destination:") {
-				// Send other download-related messages
-				m.sendProgress(line, 0, "", "")
+				m.sendProgress(progressMessage(event), event)
 			}
-		}
+		}()
 	}
+	wg.Wait()
+
+	// Wait for command to complete
+	result.err = cmd.Wait()
+	result.stderr = errOutput.String()
+	result.skipped = skipped.Load() && ctx.Err() == nil
+	return result
+}
+
+// Describes what a progress event is working on, for the line above the progress bar
+func progressMessage(event downloader.ProgressEvent) string {
+	msg := "Downloading"
+	if event.Status == downloader.ProgressPostprocessing {
+		msg = "Processing"
+	}
+	if event.Filename != "" {
+		msg += " " + filepath.Base(event.Filename)
+	}
+	if event.ItemCount > 0 {
+		msg += fmt.Sprintf(" (item %d of %d)", event.ItemIndex, event.ItemCount)
+	}
+	return msg
 }
 
 var progressChan = make(chan tea.Msg, 1000)
 
-func (m *Model) sendProgress(progress string, percent float64, speed, eta string) {
+func (m *Model) sendProgress(progress string, event downloader.ProgressEvent) {
 	// Send progress update (blocking to ensure no updates are dropped)
 	progressChan <- downloadProgressMsg{
 		progress: progress,
-		percent:  percent,
-		speed:    speed,
-		eta:      eta,
+		event:    event,
 	}
 }
 
-func (m *Model) sendDownloadComplete(success bool, err error) {
+func (m *Model) sendDownloadComplete(success bool, err error, skipped int) {
 	progressChan <- downloadCompleteMsg{
 		success: success,
 		err:     err,
+		skipped: skipped,
 	}
 }
 
@@ -1092,12 +1511,18 @@ func (m *Model) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case downloadProgressMsg:
 		m.downloadProgress = msg.progress
-		m.downloadPercent = msg.percent
-		m.downloadSpeed = msg.speed
-		m.downloadETA = msg.eta
+		m.downloadEvent = msg.event
 		// Continue waiting for more progress updates
 		return m, waitForProgress
 	case downloadCompleteMsg:
+		m.DownloadErr = msg.err
+		if !msg.success && msg.err == nil {
+			m.DownloadErr = downloader.ErrDownloadFailed
+		}
+		if errors.Is(msg.err, context.Canceled) {
+			return m, tea.Quit
+		}
+		m.skippedItems = msg.skipped
 		if msg.success {
 			m.downloadComplete = true
 			m.state = downloadCompleteState
@@ -1113,7 +1538,22 @@ func (m *Model) updateDownloading(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c":
-			return m, tea.Quit
+			if m.cancelDownload == nil {
+				return m, tea.Quit
+			}
+			// Quit once yt-dlp has exited, a second Ctrl+C quits right away
+			m.cancelDownload()
+			m.cancelDownload = nil
+			m.downloadProgress = "Cancelling download..."
+		case "n":
+			// Only playlists have a next item to move on to
+			if m.downloadEvent.ItemCount > 0 && m.cancelDownload != nil {
+				select {
+				case m.skipItem <- struct{}{}:
+				default:
+				}
+				m.downloadProgress = "Skipping item..."
+			}
 		}
 	}
 	return m, waitForProgress
@@ -1266,6 +1706,16 @@ func (m *Model) View() string {
 			}
 			mainContent.WriteString("\n")
 		}
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		subtitles := "Subtitles: off (press s to toggle)"
+		if m.cfg.WriteSubs {
+			subLangs := m.cfg.SubLangs
+			if subLangs == "" {
+				subLangs = "en"
+			}
+			subtitles = fmt.Sprintf("Subtitles: %s (press s to toggle)", subLangs)
+		}
+		mainContent.WriteString("\n" + noteStyle.Render(subtitles))
 	case metadataLoadingState:
 		loadingMsg := "Fetching video info"
 		if m.cfg.CookieBrowser != "" {
@@ -1291,6 +1741,37 @@ func (m *Model) View() string {
 			}
 			mainContent.WriteString("\n")
 		}
+	case playlistSelectState:
+		mainContent.WriteString(headerStyle.Render("Select playlist items"))
+		mainContent.WriteString("\n")
+		// Show a window of items around the cursor so long playlists fit
+		const visibleItems = 12
+		start := max(0, min(m.cursor-visibleItems/2, len(m.playlistEntries)-visibleItems))
+		end := min(len(m.playlistEntries), start+visibleItems)
+		for i := start; i < end; i++ {
+			entry := m.playlistEntries[i]
+			check := "[ ]"
+			if m.playlistSelected[i] {
+				check = "[x]"
+			}
+			line := fmt.Sprintf("%s %d. %s", check, entry.Index, entry.Title)
+			if entry.Duration > 0 {
+				line += " (" + formatDuration(entry.Duration) + ")"
+			}
+			if len(line) > maxContentWidth-5 {
+				line = line[:maxContentWidth-8] + "..."
+			}
+			if m.cursor == i {
+				mainContent.WriteString(selectedStyle.Render(fmt.Sprintf("> %s", line)))
+			} else {
+				mainContent.WriteString(choiceStyle.Render(fmt.Sprintf("  %s", line)))
+			}
+			mainContent.WriteString("\n")
+		}
+		_, count := playlistItemsArg(m.playlistEntries, m.playlistSelected)
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		mainContent.WriteString("\n" + noteStyle.Render(fmt.Sprintf(
+			"%d of %d selected. Space to toggle, a to select all, enter to continue.", count, len(m.playlistEntries))))
 	case formatsLoadingState:
 		mainContent.WriteString(headerStyle.Render("Fetching formats" + m.loadingDots))
 		mainContent.WriteString("\n")
@@ -1304,11 +1785,14 @@ func (m *Model) View() string {
 	case resolutionState:
 		mainContent.WriteString(headerStyle.Render("Select resolution"))
 		mainContent.WriteString("\n")
+		tableHeader, rows := formatTable(m.videoFormats)
+		mainContent.WriteString(choiceStyle.Render("  " + tableHeader))
+		mainContent.WriteString("\n")
 		for i, choice := range m.choices {
-			// Truncate choice if too long
+			// Format rows are already aligned and colored, only the default entry is plain
 			displayChoice := choice
-			if len(displayChoice) > maxContentWidth-5 {
-				displayChoice = displayChoice[:maxContentWidth-8] + "..."
+			if i > 0 && i-1 < len(rows) {
+				displayChoice = rows[i-1]
 			}
 			if m.cursor == i {
 				mainContent.WriteString(selectedStyle.Render(fmt.Sprintf("> %s", displayChoice)))
@@ -1319,7 +1803,47 @@ func (m *Model) View() string {
 		}
 		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
 		mainContent.WriteString("\n" + noteStyle.Render(
-			"Note: Some formats may be restricted by YouTube.\nIf download fails, try Default or run `yt-dlp --list-formats <URL>`."))
+			"Note: Some formats may be restricted by YouTube.\nIf download fails, try Default or run `yt-dlp --list-formats <URL>`.\nPress a to download audio only."))
+	case fragmentsState:
+		mainContent.WriteString(headerStyle.Render("Concurrent fragments for this HLS/DASH format"))
+		mainContent.WriteString("\n")
+		for i, choice := range m.choices {
+			if m.cursor == i {
+				mainContent.WriteString(selectedStyle.Render(fmt.Sprintf("> %s", choice)))
+			} else {
+				mainContent.WriteString(choiceStyle.Render(fmt.Sprintf("  %s", choice)))
+			}
+			mainContent.WriteString("\n")
+		}
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		mainContent.WriteString("\n" + noteStyle.Render("More fragments is faster on good connections but may trigger throttling."))
+	case premierePromptState:
+		mainContent.WriteString(headerStyle.Render("This video is a scheduled premiere. Wait for it to start and download? (y/n)"))
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		mainContent.WriteString("\n\n" + noteStyle.Render("yaria will keep checking until it goes live."))
+	case audioOnlyPromptState:
+		mainContent.WriteString(headerStyle.Render("Only audio is available for this video. Download audio instead? (y/n)"))
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		mainContent.WriteString("\n\n" + noteStyle.Render("Use --audio-fallback to always switch to audio without asking."))
+	case audioFormatState:
+		mainContent.WriteString(headerStyle.Render("Select audio format"))
+		mainContent.WriteString("\n")
+		for i, choice := range m.choices {
+			if m.cursor == i {
+				mainContent.WriteString(selectedStyle.Render(fmt.Sprintf("> %s", choice)))
+			} else {
+				mainContent.WriteString(choiceStyle.Render(fmt.Sprintf("  %s", choice)))
+			}
+			mainContent.WriteString("\n")
+		}
+		noteStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth)
+		normalize := "Loudness normalization: off (press n to toggle)"
+		if !m.hasFFmpeg {
+			normalize = "Loudness normalization unavailable: ffmpeg not found"
+		} else if m.cfg.AudioNormalize {
+			normalize = "Loudness normalization: on (press n to toggle)"
+		}
+		mainContent.WriteString("\n" + noteStyle.Render(normalize))
 	case downloadLocationState:
 		mainContent.WriteString(headerStyle.Render("Choose Download Location"))
 		mainContent.WriteString("\n")
@@ -1349,6 +1873,17 @@ func (m *Model) View() string {
 			displayTitle = displayTitle[:maxTitleWidth-3] + "..."
 		}
 		mainContent.WriteString(headerStyle.Render(fmt.Sprintf("Download '%s'? (y/n)", displayTitle)))
+		mainContent.WriteString("\n\n")
+		destStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth).Align(lipgloss.Center)
+		dest := m.destPath
+		if dest == "" {
+			dest = "working out destination..."
+		}
+		mainContent.WriteString(destStyle.Render("Saving to: " + dest))
+		if m.destExists {
+			warnStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true).Width(maxContentWidth).Align(lipgloss.Center)
+			mainContent.WriteString("\n" + warnStyle.Render("⚠ A file with this name already exists and won't be overwritten"))
+		}
 	case downloadingState:
 		mainContent.WriteString(headerStyle.Render("Downloading"))
 		mainContent.WriteString("\n\n")
@@ -1366,19 +1901,28 @@ func (m *Model) View() string {
 		if barWidth < 10 {
 			barWidth = 10
 		}
-		filledWidth := int(float64(barWidth) * m.downloadPercent / 100.0)
+		filledWidth := min(int(float64(barWidth)*m.downloadEvent.Percent/100.0), barWidth)
 		emptyWidth := barWidth - filledWidth
 		progressBar := strings.Repeat("█", filledWidth) + strings.Repeat("░", emptyWidth)
 		progressBarStyle := lipgloss.NewStyle().Width(maxContentWidth).Align(lipgloss.Center).Foreground(lipgloss.Color("212"))
 		mainContent.WriteString(progressBarStyle.Render(progressBar))
 		mainContent.WriteString("\n")
-		mainContent.WriteString(progressBarStyle.Render(fmt.Sprintf("%.1f%%", m.downloadPercent)))
+		mainContent.WriteString(progressBarStyle.Render(fmt.Sprintf("%.1f%%", m.downloadEvent.Percent)))
 		mainContent.WriteString("\n")
 
-		if m.downloadSpeed != "" && m.downloadETA != "" {
+		if m.downloadEvent.Speed > 0 {
+			info := "Speed: " + downloader.FormatBytes(m.downloadEvent.Speed) + "/s"
+			if m.downloadEvent.ETA > 0 {
+				info += " | ETA: " + m.downloadEvent.ETA.String()
+			}
 			infoStyle := lipgloss.NewStyle().Width(maxContentWidth).Align(lipgloss.Center).Faint(true)
 			mainContent.WriteString("\n")
-			mainContent.WriteString(infoStyle.Render(fmt.Sprintf("Speed: %s | ETA: %s", m.downloadSpeed, m.downloadETA)))
+			mainContent.WriteString(infoStyle.Render(info))
+		}
+		if m.downloadEvent.ItemCount > 0 {
+			hintStyle := lipgloss.NewStyle().Width(maxContentWidth).Align(lipgloss.Center).Faint(true)
+			mainContent.WriteString("\n")
+			mainContent.WriteString(hintStyle.Render("Press n to skip this item"))
 		}
 	case downloadCompleteState:
 		if m.downloadComplete {
@@ -1388,6 +1932,10 @@ func (m *Model) View() string {
 			mainContent.WriteString(successStyle.Render("✓ Video downloaded successfully"))
 			mainContent.WriteString("\n\n")
 			infoStyle := lipgloss.NewStyle().Faint(true).Width(maxContentWidth).Align(lipgloss.Center)
+			if m.skippedItems > 0 {
+				mainContent.WriteString(infoStyle.Render(fmt.Sprintf("Skipped %d playlist item(s)", m.skippedItems)))
+				mainContent.WriteString("\n")
+			}
 			mainContent.WriteString(infoStyle.Render("Press Enter or Ctrl+C to exit"))
 		} else if m.downloadError != "" {
 			errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true).Width(maxContentWidth).Align(lipgloss.Center)
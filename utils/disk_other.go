@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package utils
+
+import "errors"
+
+// Free space isn't available on this platform
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("free space check not supported on this platform")
+}
+
+// Assumes the same filesystem so callers skip free space checks
+func SameFilesystem(a, b string) bool {
+	return true
+}
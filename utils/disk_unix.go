@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import "syscall"
+
+// Returns the bytes available to unprivileged users on the filesystem holding path
+func FreeSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// Reports whether a and b live on the same filesystem, so a rename between them needs no space
+func SameFilesystem(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
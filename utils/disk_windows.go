@@ -0,0 +1,30 @@
+//go:build windows
+
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// Returns the bytes available to the current user on the volume holding path
+func FreeSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
+
+// Reports whether a and b live on the same volume, so a rename between them needs no space
+func SameFilesystem(a, b string) bool {
+	va, _ := filepath.Abs(a)
+	vb, _ := filepath.Abs(b)
+	return strings.EqualFold(filepath.VolumeName(va), filepath.VolumeName(vb))
+}
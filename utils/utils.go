@@ -3,6 +3,7 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -28,6 +29,56 @@ func SanitizeFilename(name string) string {
 	return name
 }
 
+// Cleans the base of a filename and re-appends ext, with or without its leading dot,
+// so the extension survives the trimming and replacement SanitizeFilename does
+func SanitizeFileBase(name, ext string) string {
+	ext = regexp.MustCompile(`[<>:"/\\|?*\s]`).ReplaceAllString(strings.TrimLeft(ext, "."), "")
+	if ext == "" {
+		return SanitizeFilename(name)
+	}
+	return SanitizeFilename(name) + "." + ext
+}
+
+// Shortens a sanitized filename to at most max characters, 0 leaves it unchanged
+func TrimFilename(name string, max int) string {
+	runes := []rune(name)
+	if max <= 0 || len(runes) <= max {
+		return name
+	}
+	return strings.TrimRight(string(runes[:max]), "_.")
+}
+
+// Parses sizes like "500M", "1.5GiB" or "12.34MiB" into bytes. Bare and binary (iB)
+// prefixes are powers of 1024 as in yt-dlp, decimal ones like "MB" are powers of 1000.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	number, unit := s, ""
+	if i >= 0 {
+		number, unit = s[:i], strings.TrimSpace(s[i:])
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit = strings.ToUpper(unit)
+	base := 1024.0
+	if len(unit) == 2 && strings.HasSuffix(unit, "B") {
+		base = 1000
+	}
+	exponent := 0
+	if unit != "" && unit != "B" {
+		exponent = strings.IndexByte("KMGT", unit[0]) + 1
+		if exponent == 0 {
+			return 0, fmt.Errorf("invalid size unit in %q", s)
+		}
+	}
+	for range exponent {
+		value *= base
+	}
+	return int64(value), nil
+}
+
 // Creates a timestamped directory name
 func GenerateTempDirName(prefix string) string {
 	return fmt.Sprintf("%s_%d", prefix, time.Now().Unix())
@@ -46,6 +97,31 @@ func CreateUniqueTempDir(baseDir string) (string, error) {
 	}
 }
 
+// Formats a byte count with binary units, e.g. "245.3 MiB"
+func HumanBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
+// Returns path, or path with _1, _2, ... before the extension when it is taken
+func UniquePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for counter := 1; FileExists(path); counter++ {
+		path = fmt.Sprintf("%s_%d%s", base, counter, ext)
+	}
+	return path
+}
+
 // Checks if a file exists
 func FileExists(path string) bool {
 	_, err := os.Stat(path)
@@ -57,7 +133,92 @@ func MoveFile(src, dest string) error {
 	if FileExists(dest) {
 		return errors.New("destination file already exists")
 	}
-	return os.Rename(src, dest)
+	if SameFilesystem(src, filepath.Dir(dest)) {
+		return os.Rename(src, dest)
+	}
+	return copyAndRemove(src, dest)
+}
+
+// Copies src to dest across filesystems, removing src only once the copy is complete
+func copyAndRemove(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// Reports whether a file is an unfinished download left by yt-dlp or aria2c
+func IsPartialFile(name string) bool {
+	lower := strings.ToLower(name)
+	for _, suffix := range []string{".part", ".ytdl", ".aria2", ".temp"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	// Fragment files of HLS/DASH downloads, e.g. video.mp4.part-Frag12
+	return strings.Contains(lower, ".part-frag")
+}
+
+// Extensions of downloaded audio and video files
+var mediaExts = []string{
+	".mp4", ".mkv", ".webm", ".mov", ".avi", ".m4v", ".flv", ".3gp", ".ts",
+	".mp3", ".m4a", ".aac", ".flac", ".wav", ".ogg", ".opus", ".alac",
+}
+
+// Reports whether a file is a finished audio or video file
+func IsMediaFile(name string) bool {
+	if IsPartialFile(name) {
+		return false
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range mediaExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Locates every media file in a directory, falling back to the first file
+// when none has a known media extension
+func FindMediaFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && IsMediaFile(info.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		file, err := FindVideoFile(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = []string{file}
+	}
+	return files, nil
 }
 
 // Locates the first video file in a directory
@@ -67,7 +228,7 @@ func FindVideoFile(dir string) (string, error) {
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.Contains(info.Name(), ".") {
+		if !info.IsDir() && strings.Contains(info.Name(), ".") && !IsPartialFile(info.Name()) {
 			videoFile = path
 			return filepath.SkipDir // Stop after finding first file
 		}
@@ -82,6 +243,58 @@ func FindVideoFile(dir string) (string, error) {
 	return videoFile, nil
 }
 
+// Expands a leading ~ to the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Environment variable overriding where dependencies are kept
+const DepsDirEnv = "YARIA_DEPS_DIR"
+
+// Picks the folder for downloaded dependencies: YARIA_DEPS_DIR, then configured, then a
+// dependencies folder next to the executable. A read-only install location like /usr/local/bin
+// falls back to ~/.yaria/dependencies.
+func ResolveDepsDir(configured string) string {
+	if dir := os.Getenv(DepsDirEnv); dir != "" {
+		return ExpandHome(dir)
+	}
+	if configured != "" {
+		return ExpandHome(configured)
+	}
+	if exePath, err := os.Executable(); err == nil {
+		dir := filepath.Join(filepath.Dir(exePath), "dependencies")
+		if dirWritable(dir) {
+			return dir
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".yaria", "dependencies")
+	}
+	cwd, _ := os.Getwd()
+	return filepath.Join(cwd, "dependencies")
+}
+
+// Reports whether dir exists or can be created, and files can be written into it
+func dirWritable(dir string) bool {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".write-test-")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
+
 // Splits a string with a separator
 func SplitN(s, sep string, n int) []string {
 	return strings.SplitN(s, sep, n)
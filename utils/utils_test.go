@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFileBase(t *testing.T) {
+	tests := []struct {
+		name, base, ext, want string
+	}{
+		{"keeps extension", "My Video", ".mp4", "My_Video.mp4"},
+		{"extension without dot", "My Video", "mkv", "My_Video.mkv"},
+		{"trailing dots in base", "Title...", ".mp3", "Title.mp3"},
+		{"invalid characters", `a<b>c:d"e/f\g|h?i*j`, ".webm", "a_b_c_d_e_f_g_h_i_j.webm"},
+		{"dots inside base", "v1.2 release", ".mp4", "v1.2_release.mp4"},
+		{"invalid characters in extension", "clip", ". m/p4", "clip.mp4"},
+		{"no extension", "Just a title.", "", "Just_a_title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFileBase(tt.base, tt.ext); got != tt.want {
+				t.Errorf("SanitizeFileBase(%q, %q) = %q, want %q", tt.base, tt.ext, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileBaseEmptyBase(t *testing.T) {
+	got := SanitizeFileBase("  ...  ", ".mp4")
+	if !strings.HasPrefix(got, "untitled_") || !strings.HasSuffix(got, ".mp4") {
+		t.Errorf("SanitizeFileBase of an empty base = %q, want untitled_<timestamp>.mp4", got)
+	}
+}